@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// ttyInputTime returns when the terminal f was last read from.
+func ttyInputTime(f *os.File) (time.Time, error) {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(st.Atimespec.Unix()), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+func ttyInputTime(f *os.File) (time.Time, error) {
+	return time.Time{}, errors.New("terminal idle time not supported on this platform")
+}
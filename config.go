@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// config is the user configuration read from config.json in configDir.
+type config struct {
+	// DistroOrder lists distros to show first in the selection menu.
+	DistroOrder []string `json:"distro_order"`
+	// RegistryPrefix is the default for --registry-prefix.
+	RegistryPrefix string `json:"registry_prefix"`
+}
+
+// loadConfig reads the config file. A missing file yields an empty config.
+func loadConfig() (*config, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "config.json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	cfg := &config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// orderedDistros returns distroList reordered so the distros in
+// cfg.DistroOrder come first, followed by the rest in registry order.
+func orderedDistros(cfg *config) ([]string, error) {
+	seen := map[string]bool{}
+	var ordered []string
+	for _, d := range cfg.DistroOrder {
+		if _, ok := distroPath[d]; !ok {
+			return nil, fmt.Errorf("distro_order: unknown distro %q", d)
+		}
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		ordered = append(ordered, d)
+	}
+	for _, d := range distroList {
+		if !seen[d] {
+			ordered = append(ordered, d)
+		}
+	}
+	return ordered, nil
+}
+
+// menuDistros returns the distros in the order the menus should show them,
+// falling back to registry order if the config is unusable.
+func menuDistros() []string {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Printf("Ignoring config: %v", err)
+		return distroList
+	}
+	ordered, err := orderedDistros(cfg)
+	if err != nil {
+		log.Printf("Ignoring config: %v", err)
+		return distroList
+	}
+	return ordered
+}
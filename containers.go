@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+)
+
+// containerInfo describes a running linuxformac container.
+type containerInfo struct {
+	ID     string
+	Name   string
+	Distro string
+}
+
+// listContainers returns running containers carrying our distro label,
+// optionally limited to one distro.
+func listContainers(containerRuntime, distro string) ([]containerInfo, error) {
+	filter := "label=" + labelDistro
+	if distro != "" {
+		filter += "=" + distro
+	}
+	format := "{{.ID}}\t{{.Names}}\t{{.Label \"" + labelDistro + "\"}}"
+	out, err := exec.Command(containerRuntime, "ps", "--filter", filter, "--format", format).Output()
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+
+	var containers []containerInfo
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		containers = append(containers, containerInfo{ID: fields[0], Name: fields[1], Distro: fields[2]})
+	}
+	return containers, scanner.Err()
+}
+
+// runAttach implements `linuxformac attach <distro>`: it opens a new shell in
+// a running container for the distro, picking one if several are running.
+func runAttach(args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: linuxformac attach <distro>")
+	}
+	distro := args[0]
+	if _, ok := distroPath[distro]; !ok {
+		log.Fatalf("unknown distro %q (supported: ubuntu, arch, fedora, debian, alpine)", distro)
+	}
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	containers, err := listContainers(containerRuntime, distro)
+	if err != nil {
+		log.Fatalf("Attach: %v", err)
+	}
+
+	var target containerInfo
+	switch len(containers) {
+	case 0:
+		if !confirm(fmt.Sprintf("No running %s container. Start a new one?", distro)) {
+			return
+		}
+		// Like the distro menu, an interactive start implicitly allows Linux testing
+		opts, err := parseArgs([]string{distro, "--test"})
+		if err != nil {
+			log.Fatalf("Attach: %v", err)
+		}
+		exitOnError(initializeVM(opts))
+		return
+	case 1:
+		target = containers[0]
+	default:
+		items := make([]string, len(containers))
+		for i, c := range containers {
+			items[i] = fmt.Sprintf("%-24s %s", c.Name, c.ID)
+		}
+		idx, err := menuSelect(fmt.Sprintf("Select a running %s container:", distro), items, 0)
+		if err != nil {
+			log.Fatalf("Container selection: %v", err)
+		}
+		target = containers[idx]
+	}
+
+	log.Printf("Attaching to %s (%s)", target.Name, target.ID)
+	execCmd := exec.Command(containerRuntime, "exec", "-it", target.ID, "sh", "-c", attachShell)
+	execCmd.Stdin = os.Stdin
+	execCmd.Stdout = os.Stdout
+	execCmd.Stderr = os.Stderr
+	if err := execCmd.Run(); err != nil {
+		log.Fatalf("Attach to %s: %v", target.Name, err)
+	}
+}
+
+// attachShell starts the user's shell in a running container. The
+// entrypoint records the account it set up in /run/linuxformac-user, which
+// differs from HOST_USER when the uid already belonged to an image user;
+// LINUXFORMAC_TMUX is set by initializeVM, and with --tmux the attach
+// rejoins the session. A container started with --user has no such
+// account, and exec already runs as its user.
+const attachShell = `if [ -n "$LINUXFORMAC_SKIP_USER" ]; then
+	if [ -n "$LINUXFORMAC_TMUX" ]; then exec tmux new-session -A -s "$LINUXFORMAC_TMUX"; fi
+	if command -v zsh > /dev/null 2>&1; then exec zsh -l; fi
+	exec sh -l
+fi
+user=$(cat /run/linuxformac-user 2> /dev/null || echo "$HOST_USER")
+if [ -n "$LINUXFORMAC_TMUX" ]; then exec su - "$user" -s /bin/zsh -c "tmux new-session -A -s $LINUXFORMAC_TMUX"; fi
+exec su - "$user" -s /bin/zsh`
+
+// runStop implements `linuxformac stop [--time N] <distro|name>`, stopping
+// every running container of a distro, or one container by name. Without
+// --time the runtime waits for the container's own --stop-timeout.
+func runStop(args []string) {
+	fs := flag.NewFlagSet("stop", flag.ExitOnError)
+	timeout := fs.String("time", "", "seconds to wait before killing, overriding the container's --stop-timeout")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: linuxformac stop [--time N] <distro|name>")
+	}
+	if *timeout != "" {
+		if err := validateStopTimeout(*timeout); err != nil {
+			log.Fatalf("Invalid --time: %v", err)
+		}
+	}
+	target := fs.Arg(0)
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	distro := ""
+	if _, ok := distroPath[target]; ok {
+		distro = target
+	}
+	containers, err := listContainers(containerRuntime, distro)
+	if err != nil {
+		log.Fatalf("Stop: %v", err)
+	}
+
+	var ids []string
+	for _, c := range containers {
+		if distro == "" && c.Name != target {
+			continue
+		}
+		log.Printf("Stopping %s (%s)", c.Name, c.ID)
+		ids = append(ids, c.ID)
+	}
+	if len(ids) == 0 {
+		log.Fatalf("No running linuxformac container matches %q.", target)
+	}
+
+	stopArgs := []string{"stop"}
+	if *timeout != "" {
+		stopArgs = append(stopArgs, "--time", *timeout)
+	}
+	stopArgs = append(stopArgs, ids...)
+
+	debugf("Stop: %s %s", containerRuntime, strings.Join(stopArgs, " "))
+	stopCmd := exec.Command(containerRuntime, stopArgs...)
+	stopCmd.Stderr = os.Stderr
+	if err := stopCmd.Run(); err != nil {
+		log.Fatalf("Stop: %v", err)
+	}
+}
+
+// runPs implements `linuxformac ps [--all]`, listing linuxformac containers
+// with their distro, status and the volume they were launched with.
+func runPs(args []string) {
+	fs := flag.NewFlagSet("ps", flag.ExitOnError)
+	all := fs.Bool("all", false, "include stopped containers")
+	fs.Parse(args)
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	psArgs := []string{"ps", "--filter", "label=" + labelDistro,
+		"--format", "{{.Names}}\t{{.Label \"" + labelDistro + "\"}}\t{{.Status}}\t{{.Label \"" + labelVolume + "\"}}"}
+	if *all {
+		psArgs = append(psArgs, "--all")
+	}
+	out, err := exec.Command(containerRuntime, psArgs...).Output()
+	if err != nil {
+		log.Fatalf("Ps: list containers: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tDISTRO\tSTATUS\tVOLUME")
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		// Containers started without a volume, or before it was recorded
+		if fields[3] == "" || fields[3] == "<no value>" {
+			fields[3] = "-"
+		}
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	tw.Flush()
+}
+
+// runStats implements `linuxformac stats [--no-stream] [name]`, showing live
+// resource usage for linuxformac containers.
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	noStream := fs.Bool("no-stream", false, "print a single snapshot and exit")
+	fs.Parse(args)
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var targets []string
+	if fs.NArg() > 0 {
+		targets = fs.Args()
+	} else {
+		containers, err := listContainers(containerRuntime, "")
+		if err != nil {
+			log.Fatalf("Stats: %v", err)
+		}
+		for _, c := range containers {
+			targets = append(targets, c.Name)
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Println("No running linuxformac containers.")
+		return
+	}
+
+	statsArgs := []string{"stats"}
+	if *noStream {
+		statsArgs = append(statsArgs, "--no-stream")
+	}
+	statsCmd := exec.Command(containerRuntime, append(statsArgs, targets...)...)
+	statsCmd.Stdin = os.Stdin
+	statsCmd.Stdout = os.Stdout
+	statsCmd.Stderr = os.Stderr
+	if err := statsCmd.Run(); err != nil {
+		log.Fatalf("Stats: %v", err)
+	}
+}
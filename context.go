@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// largeContext is the --context size above which a warning is printed,
+// since the whole directory is copied and sent to the runtime.
+const largeContext = 1 << 30
+
+// validateContextDir checks that a --context directory exists. A large
+// one is warned about by warnLaunch.
+func validateContextDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("build context: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("build context %s is not a directory", dir)
+	}
+	return nil
+}
+
+// mergeContext copies the user's context directory into the extracted
+// build context. Files from the embedded context (the Dockerfiles,
+// entrypoint.sh, starship.toml) win over files of the same name.
+func mergeContext(buildCtx, userCtx string) error {
+	return filepath.WalkDir(userCtx, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(userCtx, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(buildCtx, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		if _, err := os.Lstat(dest); err == nil {
+			log.Printf("Context file %s shadows an embedded file; keeping the embedded one.", rel)
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dest)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return copyFile(path, dest)
+	})
+}
+
+// copyFile copies a regular file, keeping its permission bits.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
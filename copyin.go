@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// splitCopyIn splits a host:container --copy-in spec. The container side
+// must be absolute, so the last colon is the separator.
+func splitCopyIn(spec string) (host, dest string, err error) {
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 || i == len(spec)-1 {
+		return "", "", fmt.Errorf("invalid copy spec %q: want host:container", spec)
+	}
+	host, dest = spec[:i], spec[i+1:]
+	if !strings.HasPrefix(dest, "/") {
+		return "", "", fmt.Errorf("invalid copy spec %q: container path must be absolute", spec)
+	}
+	return host, dest, nil
+}
+
+// validateCopyIn checks a --copy-in spec and that its host path exists.
+func validateCopyIn(spec string) error {
+	host, _, err := splitCopyIn(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(host); err != nil {
+		return fmt.Errorf("copy source: %w", err)
+	}
+	return nil
+}
+
+// runWithCopyIn replaces a plain `run`: it creates the container from the
+// same run arguments and environment, copies the --copy-in files into it,
+// then starts it, attached to stdin unless detach is set.
+func runWithCopyIn(containerRuntime string, runArgs, runEnv, copyIn []string, detach bool, stdin io.Reader) error {
+	createArgs := []string{"create"}
+	for _, a := range runArgs[1:] {
+		if a == "-d" {
+			continue
+		}
+		createArgs = append(createArgs, a)
+	}
+
+	debugf("Create: %s %s", containerRuntime, strings.Join(createArgs, " "))
+	createCmd := exec.Command(containerRuntime, createArgs...)
+	createCmd.Env = runEnv
+	createCmd.Stderr = os.Stderr
+	out, err := createCmd.Output()
+	if err != nil {
+		return fmt.Errorf("create container: %w", err)
+	}
+	id := strings.TrimSpace(string(out))
+
+	for _, spec := range copyIn {
+		host, dest, _ := splitCopyIn(spec)
+		log.Printf("Copying %s to %s", host, dest)
+		cpCmd := exec.Command(containerRuntime, "cp", host, id+":"+dest)
+		cpCmd.Stdout = os.Stdout
+		cpCmd.Stderr = os.Stderr
+		if err := cpCmd.Run(); err != nil {
+			exec.Command(containerRuntime, "rm", "-f", id).Run()
+			return fmt.Errorf("copy %s: %w", host, err)
+		}
+	}
+
+	startArgs := []string{"start"}
+	if !detach {
+		startArgs = append(startArgs, "-ai")
+	}
+	startCmd := exec.Command(containerRuntime, append(startArgs, id)...)
+	startCmd.Stdin = stdin
+	startCmd.Stdout = os.Stdout
+	startCmd.Stderr = os.Stderr
+	if err := startCmd.Run(); err != nil {
+		return fmt.Errorf("start container: %w", err)
+	}
+	if detach {
+		fmt.Println(id)
+	}
+	return nil
+}
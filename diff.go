@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// packageListCmd is the shell command that prints one installed package
+// name per line for each distro.
+var packageListCmd = map[string]string{
+	"ubuntu": "dpkg-query -W -f='${Package}\\n'",
+	"debian": "dpkg-query -W -f='${Package}\\n'",
+	"arch":   "pacman -Qq",
+	"fedora": "rpm -qa --qf '%{NAME}\\n'",
+	"alpine": "apk info -q",
+}
+
+// imagePackages lists the packages installed in image, using the package
+// manager of the distro recorded in its label.
+func imagePackages(containerRuntime, image string) ([]string, error) {
+	distro, err := imageLabel(containerRuntime, image, labelDistro)
+	if err != nil {
+		return nil, err
+	}
+	query, ok := packageListCmd[distro]
+	if !ok {
+		return nil, fmt.Errorf("%s has no %s label; only linuxformac images can be compared", image, labelDistro)
+	}
+
+	// Bypass the entrypoint: no user needs to be set up to list packages
+	cmd := exec.Command(containerRuntime, "run", "--rm", "--entrypoint", "sh", image, "-c", query)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("list packages in %s: %w", image, err)
+	}
+	pkgs := strings.Fields(string(out))
+	slices.Sort(pkgs)
+	return slices.Compact(pkgs), nil
+}
+
+// runDiff implements `linuxformac diff <imageA> <imageB>`, printing the
+// packages only B has with + and those only A has with -. A bare distro
+// name stands for its linuxformac image.
+func runDiff(args []string) {
+	if len(args) != 2 {
+		log.Fatal("usage: linuxformac diff <imageA> <imageB>")
+	}
+	images := make([]string, 2)
+	for i, arg := range args {
+		images[i] = arg
+		if _, ok := distroPath[arg]; ok {
+			images[i] = imageTagFor(arg, "")
+		}
+	}
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	a, err := imagePackages(containerRuntime, images[0])
+	if err != nil {
+		log.Fatalf("Diff: %v", err)
+	}
+	b, err := imagePackages(containerRuntime, images[1])
+	if err != nil {
+		log.Fatalf("Diff: %v", err)
+	}
+
+	for _, p := range b {
+		if _, found := slices.BinarySearch(a, p); !found {
+			fmt.Println("+", p)
+		}
+	}
+	for _, p := range a {
+		if _, found := slices.BinarySearch(b, p); !found {
+			fmt.Println("-", p)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// formatBytes renders a byte count with a binary unit suffix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// imageSize returns the size in bytes of an image as reported by inspect.
+func imageSize(containerRuntime, image string) (int64, error) {
+	out, err := exec.Command(containerRuntime, "image", "inspect", "--format", "{{.Size}}", image).Output()
+	if err != nil {
+		return 0, fmt.Errorf("inspect %s: %w", image, err)
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse size of %s: %w", image, err)
+	}
+	return size, nil
+}
+
+// dirSize sums the sizes of regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// volumeDirs returns every <name>_Volume directory linuxformac created,
+// including volumes left in the home directory from before XDG support.
+// Directories without the volume marker are not ours and are skipped.
+func volumeDirs() ([]string, error) {
+	dir, err := volumesDir()
+	if err != nil {
+		return nil, err
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*_Volume"))
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy, _ := filepath.Glob(filepath.Join(home, "*_Volume"))
+		matches = append(matches, legacy...)
+	}
+	var dirs []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err != nil || !info.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(m, volumeMarker)); err != nil {
+			debugf("Skipping %s: no %s marker", m, volumeMarker)
+			continue
+		}
+		dirs = append(dirs, m)
+	}
+	return dirs, nil
+}
+
+// runDisk implements `linuxformac disk [--prune]`.
+func runDisk(args []string) {
+	fs := flag.NewFlagSet("disk", flag.ExitOnError)
+	prune := fs.Bool("prune", false, "remove dangling linuxformac images")
+	fs.Parse(args)
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *prune {
+		pruneCmd := exec.Command(containerRuntime, "image", "prune", "-f", "--filter", "label="+labelDistro)
+		pruneCmd.Stdout = os.Stdout
+		pruneCmd.Stderr = os.Stderr
+		if err := pruneCmd.Run(); err != nil {
+			log.Fatalf("Prune images: %v", err)
+		}
+	}
+
+	images, err := listImages(containerRuntime)
+	if err != nil {
+		log.Fatalf("Disk: %v", err)
+	}
+	dirs, err := volumeDirs()
+	if err != nil {
+		log.Fatalf("Disk: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAME\tSIZE")
+
+	var imageTotal, volumeTotal int64
+	for _, img := range images {
+		size, err := imageSize(containerRuntime, img.ID)
+		if err != nil {
+			log.Printf("Skipping image %s: %v", img.Image, err)
+			continue
+		}
+		imageTotal += size
+		fmt.Fprintf(tw, "image\t%s\t%s\n", img.Image, formatBytes(size))
+	}
+	for _, dir := range dirs {
+		size, err := dirSize(dir)
+		if err != nil {
+			log.Printf("Skipping volume %s: %v", dir, err)
+			continue
+		}
+		volumeTotal += size
+		fmt.Fprintf(tw, "volume\t%s\t%s\n", dir, formatBytes(size))
+	}
+	tw.Flush()
+
+	fmt.Printf("\nImages:  %s\n", formatBytes(imageTotal))
+	fmt.Printf("Volumes: %s\n", formatBytes(volumeTotal))
+	fmt.Printf("Total:   %s\n", formatBytes(imageTotal+volumeTotal))
+}
@@ -1,15 +1,66 @@
 #!/bin/bash
 set -e
 
+# Run the --init-script, optionally as another user. A failure ends the
+# session unless --ignore-init-errors was given.
+run_init_script() {
+    [ -n "$LINUXFORMAC_INIT_SCRIPT" ] || return 0
+    script="$LINUXFORMAC_INIT_SCRIPT"
+    [ -x "$script" ] || script="bash $script"
+    status=0
+    if [ -n "$1" ]; then
+        su - "$1" -s /bin/bash -c "$script" || status=$?
+    else
+        $script || status=$?
+    fi
+    if [ "$status" -ne 0 ]; then
+        echo "linuxformac: init script exited with status $status" >&2
+        [ -n "$LINUXFORMAC_IGNORE_INIT_ERRORS" ] || exit "$status"
+    fi
+}
+
+# With --tmux, the shell runs in a tmux session that later attaches rejoin
+require_tmux() {
+    if ! command -v tmux > /dev/null 2>&1; then
+        echo "linuxformac: --tmux needs tmux, which is not installed in this image" >&2
+        exit 1
+    fi
+}
+
+# With --user the container does not start as root, so skip user setup
+if [ -n "$LINUXFORMAC_SKIP_USER" ]; then
+    run_init_script
+    if [ $# -gt 0 ]; then
+        exec "$@"
+    fi
+    if [ -n "$LINUXFORMAC_TMUX" ]; then
+        require_tmux
+        exec tmux new-session -A -s "$LINUXFORMAC_TMUX"
+    fi
+    exec /bin/zsh -l
+fi
+
 # Read environment variables
 HOST_USER="${HOST_USER:-user}"
 HOST_UID="${HOST_UID:-1000}"
 HOST_GID="${HOST_GID:-1000}"
 DISTRO_TYPE="${DISTRO_TYPE:-ubuntu}"
 
+# Match the system clock zone to --tz so tools that ignore TZ agree
+if [ -n "$TZ" ] && [ -f "/usr/share/zoneinfo/$TZ" ]; then
+    ln -sf "/usr/share/zoneinfo/$TZ" /etc/localtime
+    echo "$TZ" > /etc/timezone
+fi
+
 # Create group and user matching host UID/GID
 if ! getent group "$HOST_GID" > /dev/null 2>&1; then
-    groupadd -g "$HOST_GID" "$HOST_USER"
+    group_name="$HOST_USER"
+    # The name may already belong to a group with another gid
+    if getent group "$group_name" > /dev/null 2>&1; then
+        group_name="host$HOST_GID"
+        echo "linuxformac: group $HOST_USER exists, creating gid $HOST_GID as $group_name" >&2
+    fi
+    groupadd -g "$HOST_GID" "$group_name"
 fi
 HOST_GROUP=$(getent group "$HOST_GID" | cut -d: -f1)
 
@@ -23,6 +74,30 @@ if ! id "$HOST_USER" > /dev/null 2>&1; then
     useradd $useradd_flags "$HOST_USER" 2>/dev/null || true
 fi
 
+# If the account still does not exist, reuse whichever user the image
+# already has with this uid rather than fail
+if ! id "$HOST_USER" > /dev/null 2>&1; then
+    existing=$(getent passwd "$HOST_UID" | cut -d: -f1)
+    if [ -z "$existing" ]; then
+        echo "linuxformac: cannot create user $HOST_USER with uid $HOST_UID" >&2
+        exit 1
+    fi
+    echo "linuxformac: could not create $HOST_USER, using existing user $existing (uid $HOST_UID)" >&2
+    HOST_USER="$existing"
+fi
+# The container's environment still has the requested name; attach reads
+# the account actually in use from here
+printf '%s\n' "$HOST_USER" > /run/linuxformac-user
+
+# Give the user access to a mounted container API socket
+if [ -S /var/run/docker.sock ]; then
+    SOCK_GID=$(stat -c %g /var/run/docker.sock)
+    if ! getent group "$SOCK_GID" > /dev/null 2>&1; then
+        groupadd -g "$SOCK_GID" docker-host
+    fi
+    usermod -aG "$(getent group "$SOCK_GID" | cut -d: -f1)" "$HOST_USER" 2>/dev/null || true
+fi
+
 # Add user to sudoers (passwordless)
 echo "$HOST_USER ALL=(ALL) NOPASSWD: ALL" > /etc/sudoers.d/"$HOST_USER"
 chmod 0440 /etc/sudoers.d/"$HOST_USER"
@@ -83,11 +158,52 @@ if [ -d /data ] && mkdir -p "/data/packages/$DISTRO_TYPE" 2>/dev/null; then
     esac
 fi
 
+# Re-export passed-through variables; su - resets the login shell's environment
+: > /etc/linuxformac-env.sh
+if [ -n "$LINUXFORMAC_ENV_KEYS" ]; then
+    for key in $(echo "$LINUXFORMAC_ENV_KEYS" | tr ',' ' '); do
+        printf 'export %s=%q\n' "$key" "$(printenv "$key")" >> /etc/linuxformac-env.sh
+    done
+fi
+# Start in the --mount-cwd directory rather than the home directory
+if [ -n "$LINUXFORMAC_WORKDIR" ]; then
+    printf 'cd %q\n' "$LINUXFORMAC_WORKDIR" >> /etc/linuxformac-env.sh
+fi
+# Forward the host SSH agent
+if [ -n "$SSH_AUTH_SOCK" ]; then
+    printf 'export SSH_AUTH_SOCK=%q\n' "$SSH_AUTH_SOCK" >> /etc/linuxformac-env.sh
+fi
+chown "$HOST_UID:$HOST_GID" /etc/linuxformac-env.sh
+chmod 0600 /etc/linuxformac-env.sh
+
 # Set up user's home directory
 USER_HOME=$(eval echo "~$HOST_USER")
 
-# Create .zshrc with starship init and basic config
-cat > "$USER_HOME/.zshrc" << 'ZSHRC'
+# Copy the user's overlay into the home directory. useradd would only apply
+# /etc/skel to a new home, and on macOS the home is the host's, mounted in;
+# files already there are never replaced.
+if [ -d /etc/linuxformac/overlay ]; then
+    su "$HOST_USER" -s /bin/sh -c "cp -Rn /etc/linuxformac/overlay/. $(printf '%q' "$USER_HOME")/" || \
+        echo "linuxformac: could not copy the overlay into $USER_HOME" >&2
+fi
+
+# Write our .zshrc unless the user has their own, from the overlay or the
+# mounted home; ours starts with the marker line and is rewritten each start.
+# Older versions started it with the env comment instead.
+ZSHRC_MARKER="# Generated by linuxformac; replace this file to use your own."
+first_line=$(head -n 1 "$USER_HOME/.zshrc" 2>/dev/null || true)
+if [ ! -e "$USER_HOME/.zshrc" ] || [ "$first_line" = "$ZSHRC_MARKER" ] || [ "$first_line" = "# Variables passed in by linuxformac" ]; then
+    HISTFILE_PATH="~/.zsh_history"
+    # Persist zsh history to /data if available
+    if [ -d /data ] && mkdir -p "/data/zsh_history" 2>/dev/null; then
+        HISTFILE_PATH="/data/zsh_history/.zsh_history"
+    fi
+    {
+        echo "$ZSHRC_MARKER"
+        cat << 'ZSHRC' | sed "s|HISTFILE=~/.zsh_history|HISTFILE=$HISTFILE_PATH|"
+# Variables passed in by linuxformac
+[ -f /etc/linuxformac-env.sh ] && source /etc/linuxformac-env.sh
+
 # History
 HISTFILE=~/.zsh_history
 HISTSIZE=10000
@@ -109,19 +225,38 @@ alias ls='ls --color=auto'
 alias ll='ls -lah'
 alias la='ls -A'
 
-# Starship prompt
-export STARSHIP_CONFIG=/etc/starship.toml
-eval "$(starship init zsh)"
-ZSHRC
+# Starship prompt; a minimal --target build does not include it
+if command -v starship >/dev/null 2>&1; then
+    export STARSHIP_CONFIG=/etc/starship.toml
+    eval "$(starship init zsh)"
+fi
 
-# Persist zsh history to /data if available
-if [ -d /data ] && mkdir -p "/data/zsh_history" 2>/dev/null; then
-    # Point history file to persistent storage
-    sed -i "s|HISTFILE=~/.zsh_history|HISTFILE=/data/zsh_history/.zsh_history|" "$USER_HOME/.zshrc"
+# Colored distro tag on the right, set by linuxformac unless --no-prompt
+if [ -n "$LINUXFORMAC_PROMPT" ]; then
+    RPROMPT="%B%F{${LINUXFORMAC_PROMPT_COLOR:-blue}}[$LINUXFORMAC_PROMPT]%f%b"
+fi
+ZSHRC
+    } > "$USER_HOME/.zshrc"
+elif ! grep -q linuxformac-env.sh "$USER_HOME/.zshrc"; then
+    echo "linuxformac: keeping your .zshrc; source /etc/linuxformac-env.sh in it to get passed-in variables" >&2
 fi
 
 # Set ownership
 chown -R "$HOST_UID:$HOST_GID" "$USER_HOME"
 
-# Switch to user and start zsh
+chmod 0755 "$LINUXFORMAC_INIT_SCRIPT" 2>/dev/null || true
+run_init_script "$HOST_USER"
+
+# Run a command passed after "--" as the user, or start an interactive zsh
+if [ $# -gt 0 ]; then
+    cmd="$(printf '%q ' "$@")"
+    if [ -n "$LINUXFORMAC_WORKDIR" ]; then
+        cmd="cd $(printf '%q' "$LINUXFORMAC_WORKDIR") && $cmd"
+    fi
+    exec su - "$HOST_USER" -s /bin/zsh -c "$cmd"
+fi
+if [ -n "$LINUXFORMAC_TMUX" ]; then
+    require_tmux
+    exec su - "$HOST_USER" -s /bin/zsh -c "tmux new-session -A -s $LINUXFORMAC_TMUX"
+fi
 exec su - "$HOST_USER" -s /bin/zsh
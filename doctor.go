@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// defaultMinFree is the free space a build needs unless --min-free says otherwise.
+const defaultMinFree = "5g"
+
+// runtimeStorageDir returns where the runtime keeps images, or "" when that
+// path is not on the host (e.g. inside the podman machine or Docker Desktop
+// VM on macOS).
+func runtimeStorageDir(containerRuntime string) string {
+	if runtime.GOOS == "darwin" {
+		return ""
+	}
+	format := "{{.DockerRootDir}}"
+	if containerRuntime == "podman" {
+		format = "{{.Store.GraphRoot}}"
+	}
+	out, err := exec.Command(containerRuntime, "info", "--format", format).Output()
+	if err != nil {
+		return ""
+	}
+	dir := strings.TrimSpace(string(out))
+	if _, err := os.Stat(dir); err != nil {
+		return ""
+	}
+	return dir
+}
+
+// checkFreeSpace verifies that the runtime's storage and ctxDir, where the
+// build context is extracted, each have at least minFree bytes available.
+func checkFreeSpace(containerRuntime, minFree, ctxDir string) error {
+	need, err := parseSize(minFree)
+	if err != nil {
+		return fmt.Errorf("--min-free: %w", err)
+	}
+	if need == 0 {
+		return nil
+	}
+
+	var dirs []string
+	if dir := runtimeStorageDir(containerRuntime); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if err := os.MkdirAll(ctxDir, 0755); err == nil {
+		dirs = append(dirs, ctxDir)
+	}
+
+	for _, dir := range dirs {
+		free, err := freeSpace(dir)
+		if err != nil {
+			log.Printf("Cannot check free space on %s: %v", dir, err)
+			continue
+		}
+		if free < uint64(need) {
+			return fmt.Errorf("only %s free on %s, need %s; free up space or lower --min-free",
+				formatBytes(int64(free)), dir, formatBytes(need))
+		}
+	}
+	return nil
+}
+
+// runDoctor implements `linuxformac doctor`, checking that the host is
+// ready to build and run containers.
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	minFree := fs.String("min-free", defaultMinFree, "free space required for builds")
+	fs.Parse(args)
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		fmt.Println("FAIL runtime:", err)
+		os.Exit(1)
+	}
+	fmt.Println("ok   runtime:", containerRuntime)
+
+	if err := checkDaemon(containerRuntime); err != nil {
+		fmt.Println("FAIL daemon:", err)
+		os.Exit(1)
+	}
+	fmt.Println("ok   daemon: responding")
+
+	ctxDir, err := buildTmpDir("")
+	if err != nil {
+		fmt.Println("FAIL build dir:", err)
+		os.Exit(1)
+	}
+	if err := checkFreeSpace(containerRuntime, *minFree, ctxDir); err != nil {
+		fmt.Println("FAIL disk space:", err)
+		os.Exit(1)
+	}
+	fmt.Println("ok   disk space: at least", *minFree, "free")
+}
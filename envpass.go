@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// hostOnlyEnv lists variables that describe the host session and would be
+// wrong inside the container, so --env-all never forwards them.
+var hostOnlyEnv = map[string]bool{
+	"PATH":                    true,
+	"HOME":                    true,
+	"PWD":                     true,
+	"OLDPWD":                  true,
+	"SHELL":                   true,
+	"USER":                    true,
+	"LOGNAME":                 true,
+	"TMPDIR":                  true,
+	"SHLVL":                   true,
+	"_":                       true,
+	"SSH_AUTH_SOCK":           true,
+	"XPC_FLAGS":               true,
+	"XPC_SERVICE_NAME":        true,
+	"__CF_USER_TEXT_ENCODING": true,
+}
+
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// hostEnv returns the current environment minus host-only variables.
+// Everything else is forwarded, including any secrets it holds.
+func hostEnv() []string {
+	var vars []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if hostOnlyEnv[key] || !envKey.MatchString(key) {
+			continue
+		}
+		vars = append(vars, kv)
+	}
+	return vars
+}
+
+// readEnvFile parses KEY=VALUE lines, skipping blanks and # comments.
+func readEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open env file: %w", err)
+	}
+	defer f.Close()
+
+	var vars []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, ok := strings.Cut(line, "=")
+		if !ok || !envKey.MatchString(key) {
+			return nil, fmt.Errorf("%s:%d: want KEY=VALUE, got %q", path, n, line)
+		}
+		vars = append(vars, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+	return vars, nil
+}
+
+// passedEnv returns the KEY=VALUE pairs to set in the container. The
+// entrypoint's `su -` starts a clean login shell, so the keys are also
+// listed in LINUXFORMAC_ENV_KEYS for the entrypoint to re-export.
+func passedEnv(vars []string) []string {
+	var keys []string
+	for _, kv := range vars {
+		key, _, _ := strings.Cut(kv, "=")
+		keys = append(keys, key)
+	}
+	if len(keys) > 0 {
+		vars = append(slices.Clip(vars), "LINUXFORMAC_ENV_KEYS="+strings.Join(keys, ","))
+	}
+	return vars
+}
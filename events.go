@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// eventsOut receives newline-delimited JSON lifecycle events when
+// --events-json is set, and is nil otherwise. Log lines are still written
+// to stderr alongside; every event line is a JSON object with an "event"
+// key.
+var (
+	eventsOut io.Writer
+	eventsMu  sync.Mutex
+)
+
+// emitEvent writes one event with the given fields, if events are enabled.
+func emitEvent(name string, fields map[string]any) {
+	if eventsOut == nil {
+		return
+	}
+	ev := map[string]any{
+		"event":  name,
+		"time":   time.Now().UTC().Format(time.RFC3339Nano),
+		"run_id": runID,
+	}
+	for k, v := range fields {
+		ev[k] = v
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	eventsOut.Write(append(data, '\n'))
+}
+
+// buildProgressWriter turns build output into build_progress events, one
+// per line.
+type buildProgressWriter struct {
+	image   string
+	partial []byte
+}
+
+func (w *buildProgressWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := string(bytes.TrimRight(w.partial[:i], "\r"))
+		w.partial = w.partial[i+1:]
+		if line != "" {
+			emitEvent("build_progress", map[string]any{"image": w.image, "line": line})
+		}
+	}
+	return len(p), nil
+}
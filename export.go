@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runExportCompose implements `linuxformac export-compose <distro> [flags]`:
+// it prints a compose file describing the container the same launch would
+// run. Nothing is built or created; volumes are referenced by the paths
+// they would have.
+func runExportCompose(args []string) {
+	opts, err := parseArgs(args)
+	if err != nil {
+		log.Fatalf("Invalid arguments: %v", err)
+	}
+	if _, ok := distroPath[opts.distro]; !ok {
+		log.Fatal("usage: linuxformac export-compose <distro> [launch flags]")
+	}
+
+	in := planInputs{
+		image: imageTagForTarget(opts.distro, opts.arch, opts.target),
+		name:  opts.name,
+	}
+	// The runtime only matters for the socket paths of --docker-socket and
+	// --ssh-agent, so fall back to docker when none is installed
+	in.runtime = "docker"
+	if rt, err := detectRuntime(); err == nil {
+		in.runtime = rt
+	}
+
+	currentUser, err := user.Current()
+	if err != nil {
+		log.Fatalf("Failed to get current user: %v", err)
+	}
+	in.user, in.uid, in.gid = sanitizeUsername(currentUser.Username), currentUser.Uid, currentUser.Gid
+
+	if !opts.noVolume {
+		base := opts.distro
+		if opts.volumeName != "" {
+			base = opts.volumeName
+		}
+		if in.volume, err = volumePath(base); err != nil {
+			log.Fatalf("Export: %v", err)
+		}
+	}
+	for _, spec := range opts.dataVolumes {
+		vm, err := parseDataVolume(spec)
+		if err != nil {
+			log.Fatalf("Invalid --data-volume: %v", err)
+		}
+		path, err := volumePath(vm.Name)
+		if err != nil {
+			log.Fatalf("Export: %v", err)
+		}
+		in.dataVolumes = append(in.dataVolumes, path+":"+vm.Target)
+	}
+	if opts.mountCwd.value != "" {
+		cwd, err := currentDir()
+		if err != nil {
+			log.Fatalf("Invalid --mount-cwd: %v", err)
+		}
+		in.cwd = cwd + ":" + filepath.Clean(opts.mountCwd.value)
+	}
+
+	in.seccomp = opts.seccomp
+	if in.seccomp != "" && in.seccomp != "unconfined" {
+		if in.seccomp, err = filepath.Abs(in.seccomp); err != nil {
+			log.Fatalf("Invalid --seccomp: %v", err)
+		}
+	}
+	if in.relabel, err = selinuxRelabel(opts.selinuxLabel); err != nil {
+		log.Fatalf("Invalid --selinux-label: %v", err)
+	}
+	if in.env, err = launchEnv(opts); err != nil {
+		log.Fatalf("Invalid %v", err)
+	}
+	if opts.envAll {
+		log.Println("WARNING: --env-all writes your whole environment, including any tokens or secrets in it, into the compose file.")
+	}
+	if in.resources, err = memoryArgs(opts); err != nil {
+		log.Fatalf("Invalid memory options: %v", err)
+	}
+	cpuFlags, err := cpuArgs(opts)
+	if err != nil {
+		log.Fatalf("Invalid %v", err)
+	}
+	in.resources = append(in.resources, cpuFlags...)
+
+	spec, err := buildRunPlan(opts, in)
+	if err != nil {
+		log.Fatalf("Export: %v", err)
+	}
+	if len(opts.copyIn) > 0 || opts.initScript != "" {
+		log.Println("WARNING: --copy-in and --init-script copy files before start and are not part of the compose file.")
+	}
+	if opts.runFile != "" {
+		log.Printf("WARNING: the service reads its script from stdin; pipe %s into it.", opts.runFile)
+	}
+	writeCompose(os.Stdout, opts.distro, spec)
+}
+
+// writeCompose writes spec as a single-service compose file. Strings are
+// written as double-quoted scalars, which YAML reads like JSON strings.
+func writeCompose(w io.Writer, service string, spec *runSpec) {
+	q := strconv.Quote
+	list := func(key string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "    %s:\n", key)
+		for _, item := range items {
+			fmt.Fprintf(w, "      - %s\n", q(item))
+		}
+	}
+
+	fmt.Fprintln(w, "# Generated by linuxformac export-compose.")
+	fmt.Fprintln(w, "# The image's entrypoint creates a user from HOST_USER, HOST_UID and")
+	fmt.Fprintln(w, "# HOST_GID at start, so the container runs as root until it drops to")
+	fmt.Fprintln(w, "# that user; keep those variables. Build the image with linuxformac first.")
+	fmt.Fprintln(w, "services:")
+	fmt.Fprintf(w, "  %s:\n", service)
+	fmt.Fprintf(w, "    image: %s\n", q(spec.Image))
+	if spec.Name != "" {
+		fmt.Fprintf(w, "    container_name: %s\n", q(spec.Name))
+	}
+	fmt.Fprintf(w, "    hostname: %s\n", q(spec.Hostname))
+	if spec.Platform != "" {
+		fmt.Fprintf(w, "    platform: %s\n", q(spec.Platform))
+	}
+	fmt.Fprintln(w, "    stdin_open: true")
+	fmt.Fprintln(w, "    tty: true")
+	if spec.Restart != "" {
+		fmt.Fprintf(w, "    restart: %s\n", q(spec.Restart))
+	}
+	if spec.Init {
+		fmt.Fprintln(w, "    init: true")
+	}
+	if spec.StopWait != "" {
+		fmt.Fprintf(w, "    stop_grace_period: %s\n", q(spec.StopWait+"s"))
+	}
+	if spec.User != "" {
+		fmt.Fprintf(w, "    user: %s\n", q(spec.User))
+	}
+	if spec.UserNS != "" {
+		fmt.Fprintf(w, "    userns_mode: %s\n", q(spec.UserNS))
+	}
+	if spec.PID != "" {
+		fmt.Fprintf(w, "    pid: %s\n", q(spec.PID))
+	}
+	if spec.IPC != "" {
+		fmt.Fprintf(w, "    ipc: %s\n", q(spec.IPC))
+	}
+	if spec.Cgroup != "" {
+		fmt.Fprintf(w, "    cgroup_parent: %s\n", q(spec.Cgroup))
+	}
+	if spec.Workdir != "" {
+		fmt.Fprintf(w, "    working_dir: %s\n", q(spec.Workdir))
+	}
+	list("labels", spec.Labels)
+	list("annotations", spec.Annotate)
+	list("environment", spec.Env)
+	list("volumes", spec.Mounts)
+	list("devices", spec.Devices)
+	list("extra_hosts", spec.AddHosts)
+	list("dns", spec.DNS)
+	list("dns_search", spec.DNSSearch)
+	list("security_opt", spec.Security)
+
+	if len(spec.Ulimits) > 0 {
+		fmt.Fprintln(w, "    ulimits:")
+		for _, u := range spec.Ulimits {
+			name, limits, _ := strings.Cut(u, "=")
+			soft, hard, ok := strings.Cut(limits, ":")
+			if !ok {
+				hard = soft
+			}
+			fmt.Fprintf(w, "      %s:\n        soft: %s\n        hard: %s\n", name, soft, hard)
+		}
+	}
+
+	// Resource limits are rendered as run flags; map them to compose keys
+	for i := 0; i < len(spec.Extra); i++ {
+		switch spec.Extra[i] {
+		case "--memory":
+			i++
+			fmt.Fprintf(w, "    mem_limit: %s\n", q(spec.Extra[i]))
+		case "--memory-reservation":
+			i++
+			fmt.Fprintf(w, "    mem_reservation: %s\n", q(spec.Extra[i]))
+		case "--oom-score-adj":
+			i++
+			fmt.Fprintf(w, "    oom_score_adj: %s\n", spec.Extra[i])
+		case "--cpus":
+			i++
+			fmt.Fprintf(w, "    cpus: %s\n", spec.Extra[i])
+		case "--cpuset-cpus":
+			i++
+			fmt.Fprintf(w, "    cpuset: %s\n", q(spec.Extra[i]))
+		case "--cpuset-mems":
+			i++
+			fmt.Fprintln(w, "    # --cpuset-mems has no compose equivalent and is not exported.")
+		case "--oom-kill-disable":
+			fmt.Fprintln(w, "    oom_kill_disable: true")
+		}
+	}
+
+	if spec.GPUs != "" {
+		fmt.Fprintln(w, "    # --gpus is not exported; see the compose GPU support documentation.")
+	}
+	list("command", spec.Command)
+
+	if spec.Network != "" {
+		fmt.Fprintf(w, "    networks:\n      - %s\nnetworks:\n  %s:\n    external: true\n", q(spec.Network), q(spec.Network))
+	}
+}
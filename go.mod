@@ -2,7 +2,6 @@ module linuxformac
 
 go 1.25.6
 
-require (
-	golang.org/x/sys v0.40.0 // indirect
-	golang.org/x/term v0.39.0 // indirect
-)
+require golang.org/x/term v0.39.0
+
+require golang.org/x/sys v0.40.0 // indirect
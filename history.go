@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxHistory caps how many launches are remembered.
+const maxHistory = 20
+
+// historyEntry records a single launch so it can be repeated later.
+type historyEntry struct {
+	Distro string `json:"distro"`
+	// Name is the --name given, which a relaunch passes again
+	Name string `json:"name,omitempty"`
+	// Container is the name the container actually ran under
+	Container string    `json:"container,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func historyPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.json"), nil
+}
+
+// loadHistory returns recorded launches, most recent first.
+// A missing history file is not an error.
+func loadHistory() ([]historyEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse history %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// recordLaunch prepends a launch of container to the history file,
+// dropping any older entry for the same distro and --name and trimming to
+// maxHistory.
+func recordLaunch(distro, name, container string) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+
+	updated := []historyEntry{{Distro: distro, Name: name, Container: container, Time: time.Now()}}
+	for _, e := range entries {
+		if e.Distro == distro && e.Name == name {
+			continue
+		}
+		updated = append(updated, e)
+	}
+	if len(updated) > maxHistory {
+		updated = updated[:maxHistory]
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create history dir: %w", err)
+	}
+	data, err := json.MarshalIndent(updated, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode history: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+	return nil
+}
+
+// runRecent shows recent launches in a menu and relaunches the chosen one.
+func runRecent() {
+	entries, err := loadHistory()
+	if err != nil {
+		log.Fatalf("Recent launches: %v", err)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No recent launches.")
+		return
+	}
+
+	items := make([]string, len(entries))
+	for i, e := range entries {
+		label := e.Distro
+		if e.Name != "" {
+			label += " (" + e.Name + ")"
+		}
+		items[i] = fmt.Sprintf("%-24s %s", label, e.Time.Local().Format("2006-01-02 15:04"))
+	}
+
+	idx, err := menuSelect("Select a recent launch:", items, 0)
+	if err != nil {
+		log.Fatalf("Recent selection: %v", err)
+	}
+
+	// Like the distro menu, an interactive pick implicitly allows Linux testing
+	launch := []string{entries[idx].Distro, "--test"}
+	if entries[idx].Name != "" {
+		launch = append(launch, "--name", entries[idx].Name)
+	}
+	opts, err := parseArgs(launch)
+	if err != nil {
+		log.Fatalf("Recent: %v", err)
+	}
+	fmt.Println("Linux Distro:", opts.distro)
+	exitOnError(initializeVM(opts))
+}
+
+// lastLaunch is the full command line of the most recent launch.
+type lastLaunch struct {
+	Args []string `json:"args"`
+	// Dir is the working directory of the launch, which --mount-cwd mounted.
+	Dir  string    `json:"dir,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// pathFlags are the launch flags whose value is a host path, relative to
+// the working directory.
+var pathFlags = map[string]bool{
+	"env-file":    true,
+	"init-script": true,
+	"run-file":    true,
+	"context":     true,
+	"seccomp":     true,
+	"tmp-dir":     true,
+	"build-log":   true,
+	"copy-in":     true,
+}
+
+// absFlagArgs returns args with the host paths of pathFlags made absolute,
+// so that a replay from another directory uses the same files.
+func absFlagArgs(args []string) []string {
+	out := slices.Clone(args)
+	for i := 0; i < len(out); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(out[i], "-"), "=")
+		if !strings.HasPrefix(out[i], "-") || !pathFlags[name] {
+			continue
+		}
+		if !hasValue {
+			// The value is the next argument
+			i++
+			if i == len(out) {
+				break
+			}
+			value = out[i]
+			out[i] = absFlagValue(name, value)
+		} else {
+			out[i] = "--" + name + "=" + absFlagValue(name, value)
+		}
+	}
+	return out
+}
+
+// absFlagValue makes the host path in the value of flag name absolute.
+func absFlagValue(name, value string) string {
+	if name == "seccomp" && value == "unconfined" {
+		return value
+	}
+	if name == "copy-in" {
+		host, dest, err := splitCopyIn(value)
+		if err != nil {
+			return value
+		}
+		if abs, err := filepath.Abs(host); err == nil {
+			return abs + ":" + dest
+		}
+		return value
+	}
+	if abs, err := filepath.Abs(value); err == nil {
+		return abs
+	}
+	return value
+}
+
+func lastLaunchPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "last.json"), nil
+}
+
+// saveLastLaunch stores opts as a command line that `linuxformac last`
+// can replay: the distro, the flags with their host paths made absolute,
+// and any command after "--". The working directory is kept for
+// --mount-cwd.
+func saveLastLaunch(opts *options) error {
+	args := append([]string{opts.distro}, absFlagArgs(opts.flagArgs)...)
+	// A distro picked from the menu implies --test
+	if opts.testMode && !slices.Contains(args, "--test") && !slices.Contains(args, "-test") {
+		args = append(args, "--test")
+	}
+	if len(opts.command) > 0 {
+		args = append(append(args, "--"), opts.command...)
+	}
+
+	path, err := lastLaunchPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	last := lastLaunch{Args: args, Time: time.Now()}
+	if opts.mountCwd.value != "" {
+		if last.Dir, err = currentDir(); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(last, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode last launch: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write last launch: %w", err)
+	}
+	return nil
+}
+
+// runLast implements `linuxformac last` (or `linuxformac -`), repeating the
+// most recent launch with the same distro and flags.
+func runLast() {
+	path, err := lastLaunchPath()
+	if err != nil {
+		log.Fatalf("Last launch: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		fmt.Println("No previous launch.")
+		return
+	}
+	if err != nil {
+		log.Fatalf("Last launch: %v", err)
+	}
+	var last lastLaunch
+	if err := json.Unmarshal(data, &last); err != nil {
+		log.Fatalf("Last launch: parse %s: %v", path, err)
+	}
+
+	fmt.Println("Replaying: linuxformac", strings.Join(last.Args, " "))
+	opts, err := parseArgs(last.Args)
+	if err != nil {
+		log.Fatalf("Last launch: %v", err)
+	}
+	setupLogging(opts.verbose)
+	if opts.mountCwd.value != "" && last.Dir != "" {
+		// Mount the same directory as the original launch
+		if err := os.Chdir(last.Dir); err != nil {
+			log.Fatalf("Last launch: cannot mount %s again with --mount-cwd: %v", last.Dir, err)
+		}
+		log.Printf("Mounting %s as in the last launch", last.Dir)
+	}
+	fmt.Println("Linux Distro:", opts.distro)
+	exitOnError(initializeVM(opts))
+}
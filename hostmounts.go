@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// containerSSHSock is where the host SSH agent socket appears in the container.
+const containerSSHSock = "/run/host-ssh-agent.sock"
+
+// sshAgentMount returns the host:container mount that exposes the host SSH
+// agent to the container at containerSSHSock. On macOS the socket lives on
+// the host, not in the VM that runs containers, so only Docker Desktop's
+// forwarded socket can be used.
+func sshAgentMount(containerRuntime string) (string, error) {
+	hostSock := os.Getenv("SSH_AUTH_SOCK")
+	if runtime.GOOS == "darwin" {
+		if containerRuntime != "docker" {
+			return "", fmt.Errorf("%s machine does not forward the host SSH agent; use docker or copy keys in", containerRuntime)
+		}
+		// Docker Desktop forwards the host agent at this fixed path in its VM
+		hostSock = "/run/host-services/ssh-auth.sock"
+	} else {
+		if hostSock == "" {
+			return "", fmt.Errorf("SSH_AUTH_SOCK is not set; is ssh-agent running?")
+		}
+		if _, err := os.Stat(hostSock); err != nil {
+			return "", fmt.Errorf("SSH agent socket: %w", err)
+		}
+	}
+
+	return hostSock + ":" + containerSSHSock, nil
+}
+
+// dockerSocketMount returns the host:container mount that puts the host's
+// container API socket at /var/run/docker.sock inside the container.
+func dockerSocketMount(containerRuntime string) (string, error) {
+	var hostSock string
+	switch {
+	case containerRuntime == "docker":
+		// On macOS this path resolves inside the Docker Desktop VM
+		hostSock = "/var/run/docker.sock"
+	case runtime.GOOS == "darwin":
+		return "", fmt.Errorf("the podman machine API socket lives inside its VM and cannot be mounted from macOS; use docker, or run `podman machine ssh` and mount /run/podman/podman.sock from a rootful machine")
+	default:
+		hostSock = "/run/podman/podman.sock"
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+			hostSock = filepath.Join(dir, "podman", "podman.sock")
+		}
+	}
+
+	if runtime.GOOS != "darwin" {
+		if _, err := os.Stat(hostSock); err != nil {
+			if containerRuntime == "podman" {
+				return "", fmt.Errorf("%s not found; start it with `systemctl --user start podman.socket`", hostSock)
+			}
+			return "", fmt.Errorf("docker socket: %w", err)
+		}
+	}
+
+	return hostSock + ":/var/run/docker.sock", nil
+}
+
+// selinuxEnforce is where the kernel reports the SELinux mode: 1 when
+// enforcing, 0 when permissive, absent when SELinux is disabled.
+const selinuxEnforce = "/sys/fs/selinux/enforce"
+
+// selinuxRelabel resolves --selinux-label to the mount option to add to
+// bind mounts, or "" for none. Without the flag, mounts get the shared z
+// label when the host enforces SELinux, since otherwise the container is
+// denied access to them; a private Z label would lock out any other
+// session using the same volume.
+func selinuxRelabel(label string) (string, error) {
+	switch label {
+	case "z", "Z":
+		return label, nil
+	case "none":
+		return "", nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown label %q (want z, Z or none)", label)
+	}
+
+	if runtime.GOOS != "linux" {
+		return "", nil
+	}
+	data, err := os.ReadFile(selinuxEnforce)
+	if err != nil || strings.TrimSpace(string(data)) != "1" {
+		return "", nil
+	}
+	return "z", nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// watchIdle stops the named container once the terminal on stdin has seen
+// no input for timeout. Input is detected from the tty's access time, which
+// the kernel updates on every read, the same way `w` reports idle time;
+// wrapping stdin in a Go reader would hand the runtime a pipe instead of a
+// terminal and break -it. Call the returned function to stop watching; the
+// flag reports whether the idle stop fired.
+func watchIdle(containerRuntime, name string, timeout time.Duration) (func(), *atomic.Bool) {
+	var fired atomic.Bool
+	done := make(chan struct{})
+
+	interval := min(timeout/10, 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			last, err := ttyInputTime(os.Stdin)
+			if err != nil {
+				log.Printf("Idle timeout disabled: %v", err)
+				return
+			}
+			if time.Since(last) < timeout {
+				continue
+			}
+			fired.Store(true)
+			log.Printf("No input for %s, stopping %s.", timeout, name)
+			exec.Command(containerRuntime, "stop", name).Run()
+			return
+		}
+	}()
+
+	return func() { close(done) }, &fired
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+)
+
+// labelContextSHA records the checksum of the build context an image was
+// built from, so a stale image can be detected after an upgrade or a change
+// to --context.
+const labelContextSHA = "linuxformac.context-sha"
+
+// contextSum returns the hex SHA-256 of the build context buildImage sends
+// for distro's dockerfile: the embedded files other than the other
+// Dockerfiles, the distro's overlay, and userCtx if set. Names, permissions
+// and contents are all hashed, so editing the overlay marks the image stale.
+func contextSum(distro, dockerfile, userCtx string) (string, error) {
+	h := sha256.New()
+	err := fs.WalkDir(dockerFiles, "dockerfiles", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name := path.Base(p)
+		if strings.HasPrefix(name, "Dockerfile.") && name != dockerfile {
+			return nil
+		}
+		data, err := dockerFiles.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read embedded %s: %w", p, err)
+		}
+		fmt.Fprintf(h, "file %s %d\n", name, len(data))
+		h.Write(data)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	overlay, err := overlayDir(distro)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(overlay); err == nil && info.IsDir() {
+		if err := hashTree(h, "overlay", overlay); err != nil {
+			return "", fmt.Errorf("checksum overlay: %w", err)
+		}
+	}
+	if userCtx != "" {
+		if err := hashTree(h, "context", userCtx); err != nil {
+			return "", fmt.Errorf("checksum build context: %w", err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashTree adds every directory, symlink and regular file under root to h,
+// named by prefix joined with its path relative to root.
+func hashTree(h hash.Hash, prefix, root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		switch {
+		case d.IsDir():
+			fmt.Fprintf(h, "dir %s\n", name)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link %s %s\n", name, link)
+		case d.Type().IsRegular():
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "file %s %o %d\n", name, info.Mode().Perm(), info.Size())
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// defaultBaseImage returns the BASE_IMAGE default declared in an embedded
+// Dockerfile.
+func defaultBaseImage(dockerfile string) (string, error) {
+	data, err := dockerFiles.ReadFile("dockerfiles/" + dockerfile)
+	if err != nil {
+		return "", fmt.Errorf("read embedded %s: %w", dockerfile, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if ref, ok := strings.CutPrefix(strings.TrimSpace(line), "ARG BASE_IMAGE="); ok {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("%s declares no BASE_IMAGE default", dockerfile)
+}
+
+// pullBaseImage pulls ref unless it is already present, so its download
+// progress is shown on its own rather than inside the build output.
+func pullBaseImage(containerRuntime, ref, arch string, quiet bool) error {
+	if exec.Command(containerRuntime, "image", "inspect", ref).Run() == nil {
+		debugf("Base image %s already present", ref)
+		return nil
+	}
+	pullArgs := []string{"pull"}
+	if arch != "" {
+		pullArgs = append(pullArgs, "--platform", "linux/"+arch)
+	}
+	pullArgs = append(pullArgs, ref)
+	log.Printf("Pulling base image %s...", ref)
+	debugf("Pull: %s %s", containerRuntime, strings.Join(pullArgs, " "))
+	pullCmd := exec.Command(containerRuntime, pullArgs...)
+	if !quiet {
+		pullCmd.Stdout = os.Stdout
+	}
+	pullErr := &tailBuffer{max: 4096}
+	pullCmd.Stderr = io.MultiWriter(os.Stderr, pullErr)
+	if err := pullCmd.Run(); err != nil {
+		if looksUnauthorized(pullErr.String()) {
+			return fmt.Errorf("pull %s: %s", ref, loginHint(containerRuntime, ref))
+		}
+		return fmt.Errorf("pull %s: %w", ref, err)
+	}
+	return nil
+}
+
+// brokenImagePatterns are runtime errors that mean an image's layers are
+// missing or corrupt, typically after an interrupted build or pull.
+var brokenImagePatterns = []string{
+	"layer does not exist",
+	"layer not known",
+	"unknown blob",
+	"failed to register layer",
+	"error creating overlay mount",
+	"error getting layer",
+	"mount snapshot",
+}
+
+// looksBroken reports whether runtime error output points at a broken image.
+func looksBroken(output string) bool {
+	output = strings.ToLower(output)
+	for _, p := range brokenImagePatterns {
+		if strings.Contains(output, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	buf []byte
+	max int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string { return string(t.buf) }
+
+// verifyImage starts image with a no-op command to prove its layers are
+// usable. The entrypoint is bypassed so no user setup runs.
+func verifyImage(containerRuntime, image string) error {
+	out, err := exec.Command(containerRuntime, "run", "--rm", "--entrypoint", "true", image).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if looksBroken(string(out)) {
+		return fmt.Errorf("%s is damaged (%s); rebuild it with --force-rebuild", image, strings.TrimSpace(string(out)))
+	}
+	return fmt.Errorf("%s does not start: %w: %s", image, err, strings.TrimSpace(string(out)))
+}
+
+// imageLabel returns the value of label on image, or "" if it is not set.
+func imageLabel(containerRuntime, image, label string) (string, error) {
+	out, err := exec.Command(containerRuntime, "image", "inspect",
+		"--format", "{{index .Config.Labels "+strconv.Quote(label)+"}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("inspect %s: %w", image, err)
+	}
+	value := strings.TrimSpace(string(out))
+	if value == "<no value>" {
+		return "", nil
+	}
+	return value, nil
+}
+
+// imageCreated returns when image was created. Both runtimes marshal the
+// creation time as an RFC 3339 string.
+func imageCreated(containerRuntime, image string) (time.Time, error) {
+	out, err := exec.Command(containerRuntime, "image", "inspect", "--format", "{{json .Created}}", image).Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("inspect %s: %w", image, err)
+	}
+	var created time.Time
+	if err := json.Unmarshal(bytes.TrimSpace(out), &created); err != nil {
+		return time.Time{}, fmt.Errorf("parse creation time of %s: %w", image, err)
+	}
+	return created, nil
+}
+
+// baseImageNewer reports whether the locally cached base image was created
+// after image, i.e. a fresh base has been pulled since image was built.
+// An uncached base image is not newer: nothing is fetched to find out.
+func baseImageNewer(containerRuntime, image, base string) (bool, error) {
+	if exec.Command(containerRuntime, "image", "inspect", base).Run() != nil {
+		debugf("Base image %s is not cached; skipping the age check", base)
+		return false, nil
+	}
+	built, err := imageCreated(containerRuntime, image)
+	if err != nil {
+		return false, err
+	}
+	baseCreated, err := imageCreated(containerRuntime, base)
+	if err != nil {
+		return false, err
+	}
+	return baseCreated.After(built), nil
+}
+
+// imageTagForTarget is imageTagFor with the --target stage as the tag, so
+// that each stage is a separate image and none is reused as another.
+func imageTagForTarget(distro, arch, target string) string {
+	tag := imageTagFor(distro, arch)
+	if target != "" {
+		tag += ":" + target
+	}
+	return tag
+}
+
+// dockerfileStages returns the stage names an embedded Dockerfile declares
+// with FROM ... AS <name>, in order.
+func dockerfileStages(dockerfile string) ([]string, error) {
+	data, err := dockerFiles.ReadFile("dockerfiles/" + dockerfile)
+	if err != nil {
+		return nil, fmt.Errorf("read embedded %s: %w", dockerfile, err)
+	}
+	var stages []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 4 && strings.EqualFold(fields[0], "FROM") && strings.EqualFold(fields[2], "AS") {
+			stages = append(stages, fields[3])
+		}
+	}
+	return stages, nil
+}
+
+// validateTarget checks that dockerfile declares the stage target.
+func validateTarget(dockerfile, target string) error {
+	stages, err := dockerfileStages(dockerfile)
+	if err != nil {
+		return err
+	}
+	if len(stages) == 0 {
+		return fmt.Errorf("%s has a single stage; no target can be chosen", dockerfile)
+	}
+	if !slices.Contains(stages, target) {
+		return fmt.Errorf("%s has no stage %q (stages: %s)", dockerfile, target, strings.Join(stages, ", "))
+	}
+	return nil
+}
+
+// imageTagFor returns the image tag for distro built for arch. Images for
+// a foreign architecture get an -<arch> suffix so they never replace, or
+// get reused as, the native image.
+func imageTagFor(distro, arch string) string {
+	tag := "linuxformac-" + distro
+	if arch != "" && arch != runtime.GOARCH {
+		tag += "-" + arch
+	}
+	return tag
+}
+
+// validateArch checks an --arch value against the architectures the
+// embedded Dockerfiles support.
+func validateArch(arch string) error {
+	switch arch {
+	case "amd64", "arm64":
+		return nil
+	}
+	return fmt.Errorf("unsupported architecture %q (want amd64 or arm64)", arch)
+}
+
+// imageInfo describes one linuxformac image as reported by the runtime.
+type imageInfo struct {
+	Distro  string `json:"distro"`
+	Arch    string `json:"arch,omitempty"`
+	Target  string `json:"target,omitempty"` // the --target stage, from the tag
+	Image   string `json:"image"`
+	ID      string `json:"id"`
+	Size    string `json:"size"`
+	Created string `json:"created"`
+}
+
+// imageListFormat asks the runtime for one JSON object per image. Both
+// docker and podman accept these template fields and the json function.
+const imageListFormat = `{"image":{{json .Repository}},"tag":{{json .Tag}},"id":{{json .ID}},"size":{{json .Size}},"created":{{json .CreatedAt}}}`
+
+// listImages returns the linuxformac-<distro> images known to the runtime.
+func listImages(containerRuntime string) ([]imageInfo, error) {
+	out, err := exec.Command(containerRuntime, "images", "--format", imageListFormat).Output()
+	if err != nil {
+		return nil, fmt.Errorf("list images: %w", err)
+	}
+
+	var images []imageInfo
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var row struct {
+			imageInfo
+			Tag string `json:"tag"`
+		}
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parse image list: %w", err)
+		}
+
+		// podman reports local builds as localhost/<name>
+		distro, ok := strings.CutPrefix(path.Base(row.Image), "linuxformac-")
+		if !ok {
+			continue
+		}
+		info := row.imageInfo
+		for _, arch := range []string{"amd64", "arm64"} {
+			if d, ok := strings.CutSuffix(distro, "-"+arch); ok {
+				distro, info.Arch = d, arch
+			}
+		}
+		info.Distro = distro
+		if row.Tag != "" && row.Tag != "<none>" {
+			info.Image += ":" + row.Tag
+			// A --target build is tagged with its stage
+			if row.Tag != "latest" {
+				info.Target = row.Tag
+			}
+		}
+		images = append(images, info)
+	}
+	return images, nil
+}
+
+// parseFormat parses a --format template. Like docker's, it may use
+// {{json .}} to print a value as JSON.
+func parseFormat(format string) (*template.Template, error) {
+	return template.New("format").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(format)
+}
+
+// runList implements `linuxformac list [--json | --format T]`.
+func runList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print images as a JSON array")
+	format := fs.String("format", "", "print each image with a Go template, e.g. '{{.Distro}} {{.Size}}'")
+	fs.Parse(args)
+
+	var tmpl *template.Template
+	if *format != "" {
+		if *asJSON {
+			log.Fatal("--json and --format cannot be combined.")
+		}
+		var err error
+		if tmpl, err = parseFormat(*format); err != nil {
+			log.Fatalf("Invalid --format: %v", err)
+		}
+	}
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	images, err := listImages(containerRuntime)
+	if err != nil {
+		log.Fatalf("List: %v", err)
+	}
+
+	if tmpl != nil {
+		for _, img := range images {
+			if err := tmpl.Execute(os.Stdout, img); err != nil {
+				log.Fatalf("List: %v", err)
+			}
+			fmt.Println()
+		}
+		return
+	}
+
+	if *asJSON {
+		if images == nil {
+			images = []imageInfo{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(images); err != nil {
+			log.Fatalf("List: %v", err)
+		}
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DISTRO\tIMAGE\tID\tSIZE\tCREATED")
+	for _, img := range images {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", img.Distro, img.Image, img.ID, img.Size, img.Created)
+	}
+	tw.Flush()
+}
+
+// runInspect implements `linuxformac inspect [--arch A] [--format T] <distro>`,
+// printing the distro's image as JSON or through a template.
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	arch := fs.String("arch", "", "inspect the image built for this architecture")
+	target := fs.String("target", "", "inspect the image built with this --target stage")
+	format := fs.String("format", "", "print the image with a Go template, e.g. '{{.Distro}} {{.Size}}'")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("usage: linuxformac inspect [--arch A] [--target S] [--format T] <distro>")
+	}
+	distro := fs.Arg(0)
+	if _, ok := distroPath[distro]; !ok {
+		log.Fatalf("unknown distro %q (supported: ubuntu, arch, fedora, debian, alpine)", distro)
+	}
+
+	var tmpl *template.Template
+	if *format != "" {
+		var err error
+		if tmpl, err = parseFormat(*format); err != nil {
+			log.Fatalf("Invalid --format: %v", err)
+		}
+	}
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	images, err := listImages(containerRuntime)
+	if err != nil {
+		log.Fatalf("Inspect: %v", err)
+	}
+
+	want := path.Base(imageTagForTarget(distro, *arch, *target))
+	if *target == "" {
+		want += ":latest"
+	}
+	for _, img := range images {
+		if path.Base(img.Image) != want {
+			continue
+		}
+		if tmpl != nil {
+			if err := tmpl.Execute(os.Stdout, img); err != nil {
+				log.Fatalf("Inspect: %v", err)
+			}
+			fmt.Println()
+			return
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(img); err != nil {
+			log.Fatalf("Inspect: %v", err)
+		}
+		return
+	}
+	log.Fatalf("No %s image; launch %s first to build it.", want, distro)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buildLockTimeout bounds how long a launch waits for another process's
+// build of the same image. The kernel drops a lock when its holder exits,
+// so a crashed build never leaves it behind; this only guards against a
+// build that hangs.
+const buildLockTimeout = 30 * time.Minute
+
+// lockImage takes an exclusive lock for building tag, waiting while
+// another process holds it. The returned function releases it.
+func lockImage(tag string) (func(), error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "locks")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create lock dir: %w", err)
+	}
+	path := filepath.Join(dir, strings.ReplaceAll(tag, "/", "_")+".lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock: %w", err)
+	}
+
+	deadline := time.Now().Add(buildLockTimeout)
+	waiting := false
+	for {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if ok {
+			break
+		}
+		if !waiting {
+			holder, _ := os.ReadFile(path)
+			log.Printf("Waiting for another build of %s (pid %s) to finish...", tag, strings.TrimSpace(string(holder)))
+			waiting = true
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("gave up after %s waiting for the build lock %s; stop the other build or try again", buildLockTimeout, path)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	// Record the holder for anyone waiting
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return func() {
+		unlock(f)
+		f.Close()
+	}, nil
+}
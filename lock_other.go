@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Builds are not locked on this platform.
+func tryLock(f *os.File) (bool, error) { return true, nil }
+
+func unlock(f *os.File) {}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+// runID is a short random ID prefixed to every log line so messages from a
+// single invocation can be told apart in pasted logs.
+var runID = newRunID()
+
+// verbose enables debugf output; set from --verbose.
+var verbose bool
+
+func newRunID() string {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "------"
+	}
+	return hex.EncodeToString(b)
+}
+
+// setupLogging configures the standard logger with timestamps and the run ID.
+// Verbose mode also adds the source location of each message.
+func setupLogging(v bool) {
+	verbose = v
+	flags := log.LstdFlags | log.Lmicroseconds
+	if verbose {
+		flags |= log.Lshortfile
+	}
+	log.SetFlags(flags)
+	log.SetPrefix("[" + runID + "] ")
+}
+
+// debugf logs only in verbose mode.
+func debugf(format string, args ...any) {
+	if verbose {
+		log.Output(2, "DEBUG: "+fmt.Sprintf(format, args...))
+	}
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/term"
 )
@@ -18,6 +28,39 @@ import (
 //go:embed dockerfiles/*
 var dockerFiles embed.FS
 
+// distroPromptColor is the 256-color code each distro's prompt tag uses.
+var distroPromptColor = map[string]string{
+	"ubuntu": "208",
+	"debian": "161",
+	"arch":   "33",
+	"fedora": "27",
+	"alpine": "38",
+}
+
+// distroInfo is per-distro metadata shown before a first build.
+type distroInfo struct {
+	Description string
+	Size        string // approximate download for the base image and packages
+}
+
+var distroMeta = map[string]distroInfo{
+	"ubuntu": {Description: "Ubuntu LTS", Size: "300 MB"},
+	"debian": {Description: "Debian stable", Size: "300 MB"},
+	"arch":   {Description: "Arch Linux, rolling release", Size: "700 MB"},
+	"fedora": {Description: "Fedora", Size: "500 MB"},
+	"alpine": {Description: "Alpine Linux, musl-based", Size: "60 MB"},
+}
+
+// containerInitScript is where --init-script is copied in the container.
+const containerInitScript = "/usr/local/bin/linuxformac-init"
+
+// labelDistro marks images and containers created by linuxformac and
+// records their distro.
+const labelDistro = "linuxformac.distro"
+
+// labelVolume records the host directory a container has mounted at /data.
+const labelVolume = "linuxformac.volume"
+
 var distroPath = map[string]string{
 	"ubuntu": "docker.io/library/ubuntu",
 	"arch":   "docker.io/archlinux/archlinux",
@@ -26,10 +69,44 @@ var distroPath = map[string]string{
 	"alpine": "docker.io/library/alpine:latest",
 }
 
-// writeEmbeddedFiles extracts the embedded dockerfiles/ to a temp directory,
-// flattening the dockerfiles/ prefix so the build context is flat.
-func writeEmbeddedFiles() (string, error) {
-	tmpDir, err := os.MkdirTemp("", "linuxformac-build-*")
+// buildTmpDir returns where build contexts are extracted: the --tmp-dir
+// flag, then $LINUXFORMAC_TMPDIR, then the cache dir.
+func buildTmpDir(flagDir string) (string, error) {
+	if flagDir != "" {
+		return flagDir, nil
+	}
+	if dir := os.Getenv("LINUXFORMAC_TMPDIR"); dir != "" {
+		return dir, nil
+	}
+	return cacheDir()
+}
+
+// validateTmpDir checks that dir is an existing, writable directory.
+func validateTmpDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("temp dir: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("temp dir %s is not a directory", dir)
+	}
+	probe, err := os.CreateTemp(dir, ".linuxformac-probe-*")
+	if err != nil {
+		return fmt.Errorf("temp dir %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// writeEmbeddedFiles extracts the embedded dockerfiles/ to a new directory
+// under parent, flattening the dockerfiles/ prefix so the build context is
+// flat.
+func writeEmbeddedFiles(parent string) (string, error) {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("create %s: %w", parent, err)
+	}
+	tmpDir, err := os.MkdirTemp(parent, "linuxformac-build-*")
 	if err != nil {
 		return "", fmt.Errorf("create temp dir: %w", err)
 	}
@@ -61,237 +138,738 @@ func writeEmbeddedFiles() (string, error) {
 	return tmpDir, nil
 }
 
-// buildImage builds (or reuses) a custom image for the given distro.
+// detectRuntime returns the first available container runtime, preferring
+// podman over docker.
+func detectRuntime() (string, error) {
+	systemContainer := []string{"podman", "docker"}
+	log.Println("Checking system for container software....")
+
+	var present []string
+	for _, container := range systemContainer {
+		command := fmt.Sprintf("which %s", container)
+		cmd := exec.Command("bash", "-c", command)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			log.Printf("%s not found: %v", container, err)
+			continue
+		}
+		log.Println(string(out))
+		present = append(present, container)
+	}
+
+	if len(present) == 0 {
+		return "", fmt.Errorf("no container runtime found (podman or docker); install a container tool")
+	}
+	return present[0], nil
+}
+
+// checkDaemon runs `<runtime> info` to make sure the daemon (or podman
+// machine) answers before anything is built, since finding the binary says
+// nothing about whether it can be used.
+func checkDaemon(containerRuntime string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, containerRuntime, "info").CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	detail := strings.TrimSpace(string(out))
+	if ctx.Err() != nil {
+		detail = "no answer after 15s"
+	}
+
+	var hint string
+	switch {
+	case containerRuntime == "docker" && runtime.GOOS == "darwin":
+		hint = "start Docker Desktop"
+	case containerRuntime == "docker":
+		hint = "start the daemon, e.g. `sudo systemctl start docker`"
+	case runtime.GOOS == "darwin":
+		hint = "start the VM with `podman machine start`"
+	default:
+		hint = "check the podman installation"
+	}
+	return fmt.Errorf("%s is installed but not responding (%s); %s", containerRuntime, detail, hint)
+}
+
+// dockerfileFor returns the name of the embedded Dockerfile for distro on
+// arch (the host architecture if empty), and checks that it was actually
+// embedded.
+func dockerfileFor(distro, arch string) (string, error) {
+	if arch == "" {
+		arch = runtime.GOARCH
+	}
+	dockerfile := "Dockerfile." + distro
+	if distro == "arch" && arch == "arm64" {
+		dockerfile = "Dockerfile.arch.arm64"
+	}
+	if _, err := fs.Stat(dockerFiles, "dockerfiles/"+dockerfile); err != nil {
+		return "", fmt.Errorf("no Dockerfile embedded for distro %s (expected dockerfiles/%s)", distro, dockerfile)
+	}
+	return dockerfile, nil
+}
+
+// buildImage builds (or reuses) a custom image for opts.distro.
 // Returns the image tag.
-func buildImage(containerRuntime, distro string) (string, error) {
-	imageTag := "linuxformac-" + distro
+func buildImage(containerRuntime string, opts *options) (string, error) {
+	distro := opts.distro
+	imageTag := imageTagForTarget(distro, opts.arch, opts.target)
+
+	// A concurrent launch of the same image waits here, then reuses it
+	unlock, err := lockImage(imageTag)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	dockerfile, err := dockerfileFor(distro, opts.arch)
+	if err != nil {
+		return "", err
+	}
+	sum, err := contextSum(distro, dockerfile, opts.context)
+	if err != nil {
+		return "", err
+	}
+
+	// The base image is --base-image or the Dockerfile's default, pulled
+	// through the registry mirror if one is configured
+	prefix, err := resolveRegistryPrefix(opts.registryPrefix)
+	if err != nil {
+		return "", err
+	}
+	base := opts.baseImage
+	if base == "" {
+		if base, err = defaultBaseImage(dockerfile); err != nil {
+			return "", err
+		}
+	}
+	base = withRegistryPrefix(base, prefix)
 
 	// Check if the image already exists
 	inspectCmd := exec.Command(containerRuntime, "image", "inspect", imageTag)
-	if err := inspectCmd.Run(); err == nil {
+	if opts.forceRebuild {
+		log.Printf("Rebuilding %s (--force-rebuild).", imageTag)
+	} else if err := inspectCmd.Run(); err == nil {
 		log.Printf("Image %s already exists, reusing.", imageTag)
+		emitEvent("build_finished", map[string]any{"image": imageTag, "distro": distro, "ok": true, "reused": true})
+		if built, err := imageLabel(containerRuntime, imageTag, labelContextSHA); err != nil {
+			debugf("Cannot check %s for staleness: %v", imageTag, err)
+		} else if built == "" {
+			log.Printf("WARNING: %s predates build context checksums and may be out of date; pass --force-rebuild to rebuild it.", imageTag)
+		} else if built != sum {
+			log.Printf("WARNING: %s was built from a different build context (%s, the embedded files, the overlay or --context) and is out of date; pass --force-rebuild to rebuild it.", imageTag, dockerfile)
+		}
+		if opts.baseImage != "" {
+			log.Printf("Note: --base-image only applies when %s is built; pass --force-rebuild to rebuild it.", imageTag)
+		} else {
+			warnIfBaseNewer(containerRuntime, imageTag, base)
+		}
 		return imageTag, nil
 	}
 
+	tmpParent, err := buildTmpDir(opts.tmpDir)
+	if err != nil {
+		return "", err
+	}
+	if err := checkFreeSpace(containerRuntime, opts.minFree, tmpParent); err != nil {
+		return "", err
+	}
+
+	// A first build pulls the base image, which can be large on a metered link
+	if !opts.forceRebuild && !opts.yes {
+		meta := distroMeta[distro]
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			log.Printf("First build of %s downloads about %s.", imageTag, meta.Size)
+		} else if !confirm(fmt.Sprintf("%s (%s) has not been built yet and needs about %s of downloads. Build it now?", imageTag, meta.Description, meta.Size)) {
+			return "", fmt.Errorf("build of %s cancelled", imageTag)
+		}
+	}
+
+	if opts.explicitPull {
+		if err := pullBaseImage(containerRuntime, base, opts.arch, opts.quiet); err != nil {
+			return "", err
+		}
+	}
+
 	log.Printf("Building custom image %s...", imageTag)
 
-	buildCtx, err := writeEmbeddedFiles()
+	buildCtx, err := writeEmbeddedFiles(tmpParent)
 	if err != nil {
 		return "", fmt.Errorf("write build context: %w", err)
 	}
-	defer os.RemoveAll(buildCtx)
+	if opts.keepContext {
+		// Logged up front so the path is known even if the build is interrupted
+		log.Printf("Keeping build context at %s", buildCtx)
+	} else {
+		defer os.RemoveAll(buildCtx)
+	}
 
-	dockerfile := "Dockerfile." + distro
-	if distro == "arch" && runtime.GOARCH == "arm64" {
-		dockerfile = "Dockerfile.arch.arm64"
+	if err := addOverlay(buildCtx, distro); err != nil {
+		return "", fmt.Errorf("copy overlay: %w", err)
+	}
+
+	if opts.context != "" {
+		log.Printf("Adding build context from %s", opts.context)
+		if err := mergeContext(buildCtx, opts.context); err != nil {
+			return "", fmt.Errorf("copy build context: %w", err)
+		}
+	}
+
+	buildArgs := []string{"build", "-t", imageTag,
+		"--label", labelDistro + "=" + distro,
+		"--label", labelContextSHA + "=" + sum,
+	}
+	if opts.arch != "" {
+		buildArgs = append(buildArgs, "--platform", "linux/"+opts.arch)
+	}
+	if opts.target != "" {
+		buildArgs = append(buildArgs, "--target", opts.target)
+	}
+	if opts.baseImage != "" || prefix != "" {
+		log.Printf("Using base image %s", base)
+		buildArgs = append(buildArgs, "--build-arg", "BASE_IMAGE="+base)
 	}
-	buildCmd := exec.Command(containerRuntime, "build", "-t", imageTag, "-f", filepath.Join(buildCtx, dockerfile), buildCtx)
-	buildCmd.Stdout = os.Stdout
-	buildCmd.Stderr = os.Stderr
+	buildArgs = append(buildArgs, "-f", filepath.Join(buildCtx, dockerfile), buildCtx)
+	debugf("Build: %s %s", containerRuntime, strings.Join(buildArgs, " "))
+	buildCmd := exec.Command(containerRuntime, buildArgs...)
+
+	// Build output goes to the terminal unless --quiet, and is also teed to
+	// --build-log. A quiet build without a log is buffered so a failure can
+	// still show what went wrong.
+	// The tail is kept to recognise a registry login failure
+	buildTail := &tailBuffer{max: 4096}
+	writers := []io.Writer{buildTail}
+	var buffered bytes.Buffer
+	if !opts.quiet {
+		writers = append(writers, os.Stdout)
+	}
+	if opts.buildLog != "" {
+		logFile, err := os.Create(opts.buildLog)
+		if err != nil {
+			return "", fmt.Errorf("create build log: %w", err)
+		}
+		defer logFile.Close()
+		writers = append(writers, logFile)
+	} else if opts.quiet {
+		writers = append(writers, &buffered)
+	}
+	if eventsOut != nil {
+		writers = append(writers, &buildProgressWriter{image: imageTag})
+	}
+	out := io.MultiWriter(writers...)
+	buildCmd.Stdout = out
+	buildCmd.Stderr = out
+
+	emitEvent("build_started", map[string]any{"image": imageTag, "distro": distro})
 	if err := buildCmd.Run(); err != nil {
+		emitEvent("build_finished", map[string]any{"image": imageTag, "distro": distro, "ok": false, "error": err.Error()})
+		if opts.buildLog != "" {
+			log.Printf("Full build output: %s", opts.buildLog)
+		} else if opts.quiet {
+			os.Stderr.Write(buffered.Bytes())
+		}
+		if looksUnauthorized(buildTail.String()) {
+			return "", fmt.Errorf("build image %s: %s", imageTag, loginHint(containerRuntime, base))
+		}
+		if opts.keepContext {
+			log.Printf("Build context kept for inspection: %s", buildCtx)
+		} else {
+			log.Println("Pass --keep-context to keep the build context for inspection.")
+		}
 		return "", fmt.Errorf("build image %s: %w", imageTag, err)
 	}
 
 	log.Printf("Image %s built successfully.", imageTag)
+	emitEvent("build_finished", map[string]any{"image": imageTag, "distro": distro, "ok": true, "reused": false})
 	return imageTag, nil
 }
 
-func initializeVM(distro string, testMode bool) error {
+// warnIfBaseNewer warns when base has been pulled since imageTag was built
+// from it, so imageTag may be missing its updates. Only the local images
+// are compared.
+func warnIfBaseNewer(containerRuntime, imageTag, base string) {
+	newer, err := baseImageNewer(containerRuntime, imageTag, base)
+	if err != nil {
+		debugf("Cannot compare %s with %s: %v", imageTag, base, err)
+		return
+	}
+	if newer {
+		log.Printf("WARNING: %s is newer than %s, which may be missing its updates; pass --force-rebuild to rebuild on top of it.", base, imageTag)
+	}
+}
+
+// buildImages builds images for several distros in parallel, reusing any
+// that already exist. It returns the distros whose build failed.
+func buildImages(containerRuntime string, distros []string, opts *options) []string {
+	var (
+		mu     sync.Mutex
+		failed []string
+		wg     sync.WaitGroup
+	)
+	for _, distro := range distros {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			distroOpts := *opts
+			distroOpts.distro = distro
+			if opts.buildLog != "" {
+				distroOpts.buildLog = opts.buildLog + "." + distro
+			}
+			if _, err := buildImage(containerRuntime, &distroOpts); err != nil {
+				log.Printf("Build %s failed: %v", distro, err)
+				mu.Lock()
+				failed = append(failed, distro)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return failed
+}
+
+// runMultiBuild lets the user tag several distros in the menu and builds
+// all of their images in parallel without launching a container.
+func runMultiBuild(opts *options) {
+	choices := menuDistros()
+	picked, err := menuMultiSelect("Select distributions to build:", choices)
+	if err != nil {
+		log.Fatalf("Distro selection: %v", err)
+	}
+	distros := make([]string, len(picked))
+	for i, idx := range picked {
+		distros[i] = choices[idx]
+	}
+
+	// Check the flags against every picked distro before building any
+	var invalid flagErrors
+	for _, d := range distros {
+		distroOpts := *opts
+		distroOpts.distro = d
+		_, err := validateLaunch(&distroOpts)
+		var errs flagErrors
+		if errors.As(err, &errs) {
+			for _, msg := range errs {
+				if !slices.Contains(invalid, msg) {
+					invalid = append(invalid, msg)
+				}
+			}
+		}
+	}
+	invalid.exitIfAny()
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Parallel builds cannot each prompt, so confirm the downloads up front
+	if !opts.yes && term.IsTerminal(int(os.Stdin.Fd())) {
+		sizes := make([]string, len(distros))
+		for i, d := range distros {
+			sizes[i] = d + " ~" + distroMeta[d].Size
+		}
+		if !confirm("Images not built yet will be downloaded (" + strings.Join(sizes, ", ") + "). Continue?") {
+			return
+		}
+	}
+	opts.yes = true
+
+	log.Printf("Building %s...", strings.Join(distros, ", "))
+	if failed := buildImages(containerRuntime, distros, opts); len(failed) > 0 {
+		log.Fatalf("Failed to build: %s", strings.Join(failed, ", "))
+	}
+	log.Println("All images built.")
+}
+
+// launchSteps is the number of phases initializeVM reports progress for:
+// runtime detection, image build, volume setup, and container launch.
+const launchSteps = 4
+
+// exitStatus is returned by initializeVM when a headless session's command
+// fails, so that linuxformac can exit with the command's own status.
+type exitStatus struct{ code int }
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.code)
+}
+
+// exitOnError ends linuxformac after a failed launch: with the command's
+// own status for an exitStatus, otherwise by logging err.
+func exitOnError(err error) {
+	if err == nil {
+		return
+	}
+	var status exitStatus
+	if errors.As(err, &status) {
+		os.Exit(status.code)
+	}
+	log.Fatalf("Error: %v", err)
+}
+
+// initializeVM builds the image for opts.distro and runs the session. It
+// returns instead of exiting on failure, so callers can clean up first.
+func initializeVM(opts *options) error {
+	distro := opts.distro
+	if opts.eventsJSON {
+		eventsOut = os.Stderr
+	}
+
 	switch runtime.GOOS {
 	case "linux":
-		if !testMode {
-			log.Fatal("Operating System: Linux. Pass --test to run.")
+		if !opts.testMode {
+			return errors.New("operating system: Linux; pass --test to run")
 		}
 		log.Println("Operating system: ", runtime.GOOS)
 		log.Println("Architecture: ", runtime.GOARCH)
 	case "windows":
-		log.Fatal("Operating System: Windows. Use WSLv2.")
+		return errors.New("operating system: Windows; use WSLv2")
 	case "darwin":
 		log.Println("Operating system: ", runtime.GOOS)
 		log.Println("Architecture: ", runtime.GOARCH)
 	}
 
-	// Validate distro
-	if _, ok := distroPath[distro]; !ok {
-		log.Fatalf("unknown distro %q (supported: ubuntu, arch, fedora, debian, alpine)", distro)
+	checks, err := validateLaunch(opts)
+	if err != nil {
+		return err
 	}
-
-	systemContainer := []string{"podman", "docker"}
-	log.Println("Checking system for container software....")
-
-	var present []string
-	for _, container := range systemContainer {
-		command := fmt.Sprintf("which %s", container)
-		cmd := exec.Command("bash", "-c", command)
-		out, err := cmd.CombinedOutput()
+	warnLaunch(opts)
+	seccomp, relabel, cwdMount := checks.seccomp, checks.relabel, checks.cwdMount
+	idleTimeout, copyIn := checks.idleTimeout, checks.copyIn
+
+	// The script replaces the terminal as the container's input
+	var stdin io.Reader = os.Stdin
+	if opts.runFile != "" {
+		script, err := os.Open(opts.runFile)
 		if err != nil {
-			log.Printf("%s not found: %v", container, err)
-			continue
+			return fmt.Errorf("invalid --run-file: %w", err)
 		}
-		log.Println(string(out))
-		present = append(present, container)
+		defer script.Close()
+		stdin = script
 	}
 
-	if len(present) == 0 {
-		log.Fatal("No container runtime found (podman or docker). Install a container tool.")
+	prog := newProgress(launchSteps, opts.quiet)
+
+	prog.Step("Detecting container runtime...")
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		return err
+	}
+	if err := checkDaemon(containerRuntime); err != nil {
+		return err
+	}
+	emitEvent("runtime_detected", map[string]any{"runtime": containerRuntime})
+	if containerRuntime == "podman" && runtime.GOOS == "darwin" && (opts.memory != "" || opts.cpus != "" || opts.cpusetCPUs != "") {
+		warnMachineResources(opts)
 	}
 
-	containerRuntime := present[0]
+	if opts.cgroupParent != "" && containerRuntime == "podman" && runtime.GOOS == "linux" && os.Geteuid() != 0 && !strings.HasSuffix(opts.cgroupParent, ".slice") {
+		log.Println("WARNING: rootless podman can only place containers in systemd slices it is delegated; a cgroupfs --cgroup-parent path will likely be refused.")
+	}
 
 	// Build custom image (pulls base image automatically)
+	prog.Step("Building image...")
 	log.Println("Initializing", distro)
-	customImageTag, err := buildImage(containerRuntime, distro)
+	customImageTag, err := buildImage(containerRuntime, opts)
 	if err != nil {
-		log.Fatalf("Failed to build custom image: %v", err)
+		return fmt.Errorf("failed to build custom image: %w", err)
+	}
+	if opts.tmux {
+		check := exec.Command(containerRuntime, "run", "--rm", "--entrypoint", "sh", customImageTag, "-c", "command -v tmux")
+		if err := check.Run(); err != nil {
+			return fmt.Errorf("--tmux needs tmux, which is not installed in %s; add it to a custom image or drop --tmux", customImageTag)
+		}
+	}
+	if opts.verifyImage {
+		if err := verifyImage(containerRuntime, customImageTag); err != nil {
+			return fmt.Errorf("image check failed: %w", err)
+		}
+		debugf("Image %s verified", customImageTag)
 	}
 
 	log.Println("Attempting to start VM....")
-	log.Println("Running container in Interactive Mode.")
+	if opts.detach {
+		log.Println("Running container in Detached Mode.")
+	} else {
+		log.Println("Running container in Interactive Mode.")
+	}
 
 	// Get host user info
 	currentUser, err := user.Current()
 	if err != nil {
-		log.Fatalf("Failed to get current user: %v", err)
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	username := sanitizeUsername(currentUser.Username)
+	if username != currentUser.Username {
+		log.Printf("Sanitized username %q to %q for the container.", currentUser.Username, username)
 	}
-	username := currentUser.Username
 	uid := currentUser.Uid
 	gid := currentUser.Gid
 
 	// Validate UID/GID are numeric (they should be on Unix)
 	if _, err := strconv.Atoi(uid); err != nil {
-		log.Fatalf("Non-numeric UID %q: %v", uid, err)
+		return fmt.Errorf("non-numeric UID %q: %w", uid, err)
 	}
 	if _, err := strconv.Atoi(gid); err != nil {
-		log.Fatalf("Non-numeric GID %q: %v", gid, err)
+		return fmt.Errorf("non-numeric GID %q: %w", gid, err)
 	}
 
-	volName, volErr := CreatePersistentVolume(distro)
+	prog.Step("Preparing volume...")
+	var volName string
+	var volErr error
+	if !opts.noVolume {
+		volumeBase := distro
+		if opts.volumeName != "" {
+			volumeBase = opts.volumeName
+		}
+		volName, volErr = CreatePersistentVolume(volumeMount{Name: volumeBase, Target: "/data"}, opts.adopt)
+	}
 
-	args := []string{"run", "-it", "--rm", "--hostname", distro,
-		"-e", "HOST_USER=" + username,
-		"-e", "HOST_UID=" + uid,
-		"-e", "HOST_GID=" + gid,
-		"-e", "DISTRO_TYPE=" + distro,
+	// Without a terminal on both ends -it would fail, so drop it. A detached
+	// container still gets a TTY so its login shell stays alive.
+	headless := opts.noTTY || opts.runFile != "" || !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd()))
+	in := planInputs{
+		runtime:   containerRuntime,
+		headless:  headless,
+		image:     customImageTag,
+		user:      username,
+		uid:       uid,
+		gid:       gid,
+		env:       checks.passEnv,
+		resources: checks.limitArgs,
+		seccomp:   seccomp,
+		relabel:   relabel,
+		cwd:       cwdMount,
 	}
 
-	if volErr != nil {
-		log.Println("Cannot create volume. Skipping")
+	if opts.noVolume {
+		log.Println("Ephemeral session: no volume is mounted, nothing under /data will persist.")
+	} else if volErr != nil {
+		if !opts.ephemeralOnVolumeError {
+			return fmt.Errorf("cannot create the /data volume: %w; fix the problem, pass --no-volume, or pass --ephemeral-on-volume-error to continue without persistence", volErr)
+		}
+		log.Printf("WARNING: cannot create volume: %v. Continuing without /data; nothing there will persist.", volErr)
 	} else {
 		log.Printf("Attaching volume: %s to %s", volName, customImageTag)
-		args = append(args, "-v", volName+":/data")
+		in.volume = volName
 	}
 
-	if runtime.GOOS == "darwin" {
-		home, err := os.UserHomeDir()
-		if err == nil && username != "" {
-			args = append(args, "-v", home+":/home/"+username)
+	for _, vm := range checks.dataVolumes {
+		path, err := CreatePersistentVolume(vm, opts.adopt)
+		if err != nil {
+			return fmt.Errorf("cannot create volume %s: %w", vm.Name, err)
 		}
+		log.Printf("Attaching volume: %s at %s", path, vm.Target)
+		in.dataVolumes = append(in.dataVolumes, path+":"+vm.Target)
+	}
+
+	// The idle watcher needs a name to stop the container by, a tmux
+	// session is named after the container, --save-on-exit commits it, and
+	// the launch history links to it
+	containerName := opts.name
+	if containerName == "" {
+		containerName = "linuxformac-" + distro + "-" + runID
 	}
+	in.name = containerName
 
-	args = append(args, customImageTag)
-	runCmd := exec.Command(containerRuntime, args...)
-	runCmd.Stdin = os.Stdin
-	runCmd.Stdout = os.Stdout
-	runCmd.Stderr = os.Stderr
-	err = runCmd.Run()
+	spec, err := buildRunPlan(opts, in)
+	if err != nil {
+		return fmt.Errorf("cannot prepare the container: %w", err)
+	}
+
+	rt := Runtime{Name: containerRuntime}
+	if len(spec.Annotate) > 0 && !rt.IsPodman() {
+		log.Println("docker does not support run-time annotations; adding them as labels instead.")
+	}
+	args, err := rt.RunArgs(spec)
 	if err != nil {
-		log.Fatalf("Failed to run VM due to error: %v", err)
+		return fmt.Errorf("cannot run with %s: %w", containerRuntime, err)
+	}
+	prog.Step("Launching container...")
+	if err := recordLaunch(distro, opts.name, containerName); err != nil {
+		log.Printf("Could not record launch history: %v", err)
+	}
+	if err := saveLastLaunch(opts); err != nil {
+		log.Printf("Could not record last launch: %v", err)
+	}
+	var idleFired func() bool
+	if idleTimeout > 0 {
+		fd := int(os.Stdin.Fd())
+		state, stateErr := term.GetState(fd)
+		stopWatch, fired := watchIdle(containerRuntime, containerName, idleTimeout)
+		idleFired = func() bool {
+			stopWatch()
+			if !fired.Load() {
+				return false
+			}
+			// The runtime was cut off mid-session; put the terminal back
+			if stateErr == nil {
+				term.Restore(fd, state)
+			}
+			return true
+		}
+	}
+
+	emitEvent("container_started", map[string]any{"image": customImageTag, "distro": distro, "name": containerName, "detach": opts.detach})
+	// Without --rm, a session cut off by a signal must be cleaned up here
+	release := func() {}
+	if opts.saveOnExit != "" {
+		release = trapSignals(func() {
+			saveOnExit(containerRuntime, containerName, opts.saveOnExit, true, opts.saveAlways)
+		})
+	}
+	// Keep the end of the runtime's errors to recognise a damaged image
+	runStderr := &tailBuffer{max: 4096}
+	if len(copyIn) > 0 {
+		err = runWithCopyIn(containerRuntime, args, rt.RunEnv(spec), copyIn, opts.detach, stdin)
+	} else {
+		debugf("Run: %s %s", containerRuntime, strings.Join(args, " "))
+		runCmd := exec.Command(containerRuntime, args...)
+		runCmd.Env = rt.RunEnv(spec)
+		runCmd.Stdin = stdin
+		runCmd.Stdout = os.Stdout
+		runCmd.Stderr = io.MultiWriter(os.Stderr, runStderr)
+		err = runCmd.Run()
+	}
+	// If a signal's cleanup is already saving the session, this waits for
+	// it and the process exits, so the session is never saved twice
+	release()
+	// A detached container keeps running after run returns
+	if !opts.detach {
+		exited := map[string]any{"name": containerName, "exit_code": 0}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exited["exit_code"] = exitErr.ExitCode()
+		} else if err != nil {
+			exited["exit_code"] = -1
+			exited["error"] = err.Error()
+		}
+		emitEvent("container_exited", exited)
+	}
+	idleStopped := idleFired != nil && idleFired()
+	if opts.saveOnExit != "" {
+		saveOnExit(containerRuntime, containerName, opts.saveOnExit, idleStopped, opts.saveAlways)
+	}
+	if idleStopped {
+		log.Println("Session stopped after idle timeout.")
+		return nil
+	}
+	if err != nil {
+		if looksBroken(runStderr.String()) {
+			return fmt.Errorf("failed to run VM: %s looks damaged; rebuild it with --force-rebuild", customImageTag)
+		}
+		// Scripted runs exit with the command's own status
+		var exitErr *exec.ExitError
+		if headless && errors.As(err, &exitErr) {
+			return exitStatus{code: exitErr.ExitCode()}
+		}
+		return fmt.Errorf("failed to run VM due to error: %w", err)
 	}
 	return nil
 }
 
 var distroList = []string{"ubuntu", "debian", "arch", "fedora", "alpine"}
 
+// readDistro reads a distro name from the first line of r, for use when
+// stdin is piped, e.g. `echo ubuntu | linuxformac`.
+func readDistro(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("read distro from stdin: %w", err)
+	}
+	distro := strings.TrimSpace(line)
+	if distro == "" {
+		return "", fmt.Errorf("no distro name on stdin")
+	}
+	if _, ok := distroPath[distro]; !ok {
+		return "", fmt.Errorf("unknown distro %q from stdin (supported: ubuntu, arch, fedora, debian, alpine)", distro)
+	}
+	return distro, nil
+}
+
 // selectDistro presents an interactive arrow-key menu and returns the chosen distro.
 func selectDistro() (string, error) {
-	fd := int(os.Stdin.Fd())
-	oldState, err := term.MakeRaw(fd)
+	distros := menuDistros()
+	idx, err := menuSelect("Select a Linux distribution:", distros, 0)
 	if err != nil {
-		return "", fmt.Errorf("enable raw mode: %w", err)
-	}
-	defer term.Restore(fd, oldState)
-
-	selected := 0
-	buf := make([]byte, 3)
-
-	render := func() {
-		// Move cursor to start and clear from here down
-		fmt.Print("\r\033[J")
-		fmt.Print("Select a Linux distribution:\r\n\r\n")
-		for i, d := range distroList {
-			if i == selected {
-				fmt.Printf("  \033[1;36m> %s\033[0m\r\n", d)
-			} else {
-				fmt.Printf("    %s\r\n", d)
-			}
-		}
-		fmt.Print("\r\nUse arrow keys to navigate, Enter to select, q to quit.\r\n")
+		return "", err
 	}
+	return distros[idx], nil
+}
 
-	// Initial render — move up to overwrite on re-render
-	render()
+var validVolumeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
 
-	for {
-		// Move cursor back up to top of menu for next render
-		lines := len(distroList) + 4 // header + blank + items + blank + help
-		fmt.Printf("\033[%dA", lines)
+// validateVolumeName checks that a --volume-name override yields a single,
+// ordinary directory name in the volumes directory.
+func validateVolumeName(name string) error {
+	if !validVolumeName.MatchString(name) {
+		return fmt.Errorf("invalid volume name %q: use letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
 
-		n, err := os.Stdin.Read(buf)
-		if err != nil {
-			return "", fmt.Errorf("read input: %w", err)
-		}
-
-		if n == 1 {
-			switch buf[0] {
-			case 'q', 'Q':
-				// Clear the menu before exiting
-				fmt.Print("\r\033[J")
-				return "", fmt.Errorf("cancelled")
-			case 13: // Enter
-				fmt.Print("\r\033[J")
-				return distroList[selected], nil
-			case 'k', 'K': // vim up
-				if selected > 0 {
-					selected--
-				}
-			case 'j', 'J': // vim down
-				if selected < len(distroList)-1 {
-					selected++
-				}
-			}
-		} else if n == 3 && buf[0] == 27 && buf[1] == '[' {
-			switch buf[2] {
-			case 'A': // Up arrow
-				if selected > 0 {
-					selected--
-				}
-			case 'B': // Down arrow
-				if selected < len(distroList)-1 {
-					selected++
-				}
-			}
-		}
+// volumeMarker is written into every volume directory linuxformac creates,
+// so an unrelated directory that happens to share the name is never
+// mounted without the user agreeing to it.
+const volumeMarker = ".linuxformac-volume"
 
-		render()
-	}
+// volumeMount is a persistent volume and where it is mounted in the container.
+type volumeMount struct {
+	Name   string
+	Target string
 }
 
-func CreatePersistentVolume(distro string) (string, error) {
-	volumeName := fmt.Sprintf("%s_Volume", distro)
+// parseDataVolume parses a --data-volume name:/mountpoint spec.
+func parseDataVolume(spec string) (volumeMount, error) {
+	name, target, ok := strings.Cut(spec, ":")
+	if !ok {
+		return volumeMount{}, fmt.Errorf("invalid data volume %q: want name:/mountpoint", spec)
+	}
+	if err := validateVolumeName(name); err != nil {
+		return volumeMount{}, err
+	}
+	if !strings.HasPrefix(target, "/") {
+		return volumeMount{}, fmt.Errorf("invalid data volume %q: mountpoint must be absolute", spec)
+	}
+	return volumeMount{Name: name, Target: filepath.Clean(target)}, nil
+}
 
-	home, err := os.UserHomeDir()
+// CreatePersistentVolume creates (or reuses) the <name>_Volume directory
+// for vm and returns its host path. The /data volume is named after the
+// distro unless overridden with --volume-name; --data-volume adds more.
+// Reusing a directory without the marker file requires adopt or an
+// interactive yes, except for a distro's default /data volume, which older
+// versions created without one and which is marked on first use.
+func CreatePersistentVolume(vm volumeMount, adopt bool) (string, error) {
+	path, err := volumePath(vm.Name)
 	if err != nil {
-		return "", fmt.Errorf("get home dir: %w", err)
+		return "", err
 	}
-
-	path := home + "/" + volumeName
-	log.Println("Volume path:", path)
+	log.Printf("Volume path: %s (mounted at %s)", path, vm.Target)
+	marker := filepath.Join(path, volumeMarker)
 
 	info, err := os.Stat(path)
 	if err == nil {
 		if !info.IsDir() {
 			return "", fmt.Errorf("volume path exists but is not a directory: %s", path)
 		}
+		if _, err := os.Stat(marker); err == nil {
+			return path, nil
+		}
+		// A distro's own /data volume predates the marker rather than
+		// belonging to something else, so upgrading does not prompt for it
+		if _, ok := distroPath[vm.Name]; ok && vm.Target == "/data" {
+			log.Printf("Marking %s, created by an earlier version, as a linuxformac volume.", path)
+		} else if !adopt {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return "", fmt.Errorf("%s has no %s marker, so it may not have been created by linuxformac; pass --adopt to mount it anyway (needed once for volumes from versions before the marker)", path, volumeMarker)
+			}
+			if !confirm(fmt.Sprintf("%s was not created by linuxformac. Mount it at %s anyway?", path, vm.Target)) {
+				return "", fmt.Errorf("not mounting %s", path)
+			}
+		}
+		if err := os.WriteFile(marker, nil, 0644); err != nil {
+			return "", fmt.Errorf("write volume marker: %w", err)
+		}
 		return path, nil
 	}
 
@@ -302,34 +880,116 @@ func CreatePersistentVolume(distro string) (string, error) {
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return "", fmt.Errorf("create volume dir: %w", err)
 	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return "", fmt.Errorf("write volume marker: %w", err)
+	}
 	return path, nil
 }
 
 func main() {
-	var linuxDistro string
-	testMode := false
+	setupLogging(false)
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "recent":
+			runRecent()
+			return
+		case "last", "-":
+			runLast()
+			return
+		case "list":
+			runList(os.Args[2:])
+			return
+		case "inspect":
+			runInspect(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "disk":
+			runDisk(os.Args[2:])
+			return
+		case "attach":
+			runAttach(os.Args[2:])
+			return
+		case "ps":
+			runPs(os.Args[2:])
+			return
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "open":
+			runOpen(os.Args[2:])
+			return
+		case "volume":
+			runVolume(os.Args[2:])
+			return
+		case "export-compose":
+			runExportCompose(os.Args[2:])
+			return
+		case "up":
+			runUp(os.Args[2:])
+			return
+		case "status":
+			runStatus(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		case "selfcheck":
+			runSelfcheck()
+			return
+		case "manage":
+			runManage()
+			return
+		case "stop":
+			runStop(os.Args[2:])
+			return
+		}
+	}
 
-	if len(os.Args) < 2 {
-		// Interactive selector — implicitly allows Linux testing
-		testMode = true
-		choice, err := selectDistro()
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid arguments: %v", err)
+	}
+	setupLogging(opts.verbose)
+
+	if opts.multi {
+		if opts.distro != "" {
+			log.Fatal("--multi picks distros from the menu; do not pass a distro name.")
+		}
+		runMultiBuild(opts)
+		return
+	}
+
+	if opts.distro == "" {
+		// A project file in the current directory stands in for the menu
+		projectOpts, err := applyProjectFile(os.Args[1:])
 		if err != nil {
-			log.Fatalf("Distro selection: %v", err)
+			log.Fatalf("Invalid project file: %v", err)
 		}
-		linuxDistro = choice
-	} else {
-		linuxDistro = os.Args[1]
-		// Check for --test flag anywhere in remaining args
-		for _, arg := range os.Args[2:] {
-			if arg == "--test" {
-				testMode = true
-				break
-			}
+		if projectOpts != nil {
+			opts = projectOpts
+			setupLogging(opts.verbose)
 		}
 	}
 
-	fmt.Println("Linux Distro:", linuxDistro)
-	if err := initializeVM(linuxDistro, testMode); err != nil {
-		log.Printf("Error: %v", err)
+	if opts.distro == "" {
+		// Interactive selector — implicitly allows Linux testing
+		opts.testMode = true
+		var choice string
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			choice, err = selectDistro()
+		} else {
+			choice, err = readDistro(os.Stdin)
+		}
+		if err != nil {
+			log.Fatalf("Distro selection: %v", err)
+		}
+		opts.distro = choice
 	}
+
+	exitIfInvalid(opts)
+	fmt.Println("Linux Distro:", opts.distro)
+	exitOnError(initializeVM(opts))
 }
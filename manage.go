@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+)
+
+// manageEntry is one line of the manage screen: an image or a running
+// container.
+type manageEntry struct {
+	label     string
+	image     *imageInfo
+	container *containerInfo
+}
+
+// runManage implements `linuxformac manage`, a menu of built images and
+// running containers. Picking one offers the actions that apply to it;
+// q leaves the screen.
+func runManage() {
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for {
+		entries, err := manageEntries(containerRuntime)
+		if err != nil {
+			log.Fatalf("Manage: %v", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No linuxformac images or containers. Launch a distro to build one.")
+			return
+		}
+
+		labels := make([]string, len(entries))
+		for i, e := range entries {
+			labels[i] = e.label
+		}
+		idx, err := menuSelect("Images and containers:", labels, 0)
+		if errors.Is(err, errMenuCancelled) {
+			return
+		}
+		if err != nil {
+			log.Fatalf("Manage: %v", err)
+		}
+
+		e := entries[idx]
+		if e.container != nil {
+			manageContainer(containerRuntime, e.container)
+		} else if manageImage(containerRuntime, e.image) {
+			// The session has ended; its container is gone
+			return
+		}
+	}
+}
+
+// manageEntries lists the images and running containers for the screen.
+func manageEntries(containerRuntime string) ([]manageEntry, error) {
+	images, err := listImages(containerRuntime)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := listContainers(containerRuntime, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []manageEntry
+	for i := range images {
+		img := &images[i]
+		entries = append(entries, manageEntry{
+			label: fmt.Sprintf("image      %-28s %-8s %s", img.Image, img.Distro, img.Size),
+			image: img,
+		})
+	}
+	for i := range containers {
+		c := &containers[i]
+		entries = append(entries, manageEntry{
+			label:     fmt.Sprintf("container  %-28s %-8s running", c.Name, c.Distro),
+			container: c,
+		})
+	}
+	return entries, nil
+}
+
+// manageImage offers launch, rebuild and remove for img. It reports
+// whether a container was launched.
+func manageImage(containerRuntime string, img *imageInfo) bool {
+	actions := []string{"Launch", "Rebuild", "Remove", "Back"}
+	idx, err := menuSelect(img.Image+":", actions, 0)
+	if err != nil || actions[idx] == "Back" {
+		return false
+	}
+
+	// Like the distro menu, an interactive pick implicitly allows Linux testing
+	launch := []string{img.Distro, "--test"}
+	if img.Arch != "" {
+		launch = append(launch, "--arch", img.Arch)
+	}
+	if img.Target != "" {
+		launch = append(launch, "--target", img.Target)
+	}
+
+	switch actions[idx] {
+	case "Launch":
+		opts, err := parseArgs(launch)
+		if err != nil {
+			log.Fatalf("Manage: %v", err)
+		}
+		exitOnError(initializeVM(opts))
+		return true
+	case "Rebuild":
+		opts, err := parseArgs(append(launch, "--force-rebuild", "--yes"))
+		if err != nil {
+			log.Fatalf("Manage: %v", err)
+		}
+		if _, err := buildImage(containerRuntime, opts); err != nil {
+			log.Printf("Rebuild failed: %v", err)
+		}
+	case "Remove":
+		if !confirm(fmt.Sprintf("Remove %s?", img.Image)) {
+			return false
+		}
+		runInTerminal(containerRuntime, "image", "rm", img.Image)
+	}
+	return false
+}
+
+// manageContainer offers attach and stop for c.
+func manageContainer(containerRuntime string, c *containerInfo) {
+	actions := []string{"Attach", "Stop", "Back"}
+	idx, err := menuSelect(c.Name+":", actions, 0)
+	if err != nil {
+		return
+	}
+	switch actions[idx] {
+	case "Attach":
+		runInTerminal(containerRuntime, "exec", "-it", c.ID, "sh", "-c", attachShell)
+	case "Stop":
+		log.Printf("Stopping %s...", c.Name)
+		runInTerminal(containerRuntime, "stop", c.ID)
+	}
+}
+
+// runInTerminal runs the runtime with the terminal attached, logging a
+// failure rather than leaving the screen.
+func runInTerminal(containerRuntime string, args ...string) {
+	debugf("Run: %s %v", containerRuntime, args)
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Printf("%s %s: %v", containerRuntime, args[0], err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// errMenuCancelled is returned by menuSelect when the user quits with q.
+var errMenuCancelled = errors.New("cancelled")
+
+// errNoTerminal is returned by menuSelect when stdin is not a TTY, such as
+// when input is piped or the tool runs in CI.
+var errNoTerminal = errors.New("stdin is not a terminal")
+
+// menuChrome is the number of lines menuSelect draws besides the items:
+// header + blank above the items, blank + help below them.
+const menuChrome = 4
+
+// menuSelect presents an interactive arrow-key menu of items, starting with
+// items[initial] highlighted, and returns the index of the chosen one.
+// It puts the terminal in raw mode for the duration and restores it on return.
+func menuSelect(title string, items []string, initial int) (int, error) {
+	selected, _, err := runMenu(title, items, initial, false)
+	return selected, err
+}
+
+// menuMultiSelect is like menuSelect but lets the user tag any number of
+// items with the spacebar. It returns the indexes of the tagged items, or
+// just the highlighted one if none were tagged.
+func menuMultiSelect(title string, items []string) ([]int, error) {
+	selected, checked, err := runMenu(title, items, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	var picked []int
+	for i, c := range checked {
+		if c {
+			picked = append(picked, i)
+		}
+	}
+	if len(picked) == 0 {
+		picked = []int{selected}
+	}
+	return picked, nil
+}
+
+// runMenu drives the menu shared by menuSelect and menuMultiSelect. In multi
+// mode each item gets a checkbox toggled by the spacebar.
+func runMenu(title string, items []string, initial int, multi bool) (int, []bool, error) {
+	if len(items) == 0 {
+		return 0, nil, fmt.Errorf("nothing to select")
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return 0, nil, errNoTerminal
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return 0, nil, fmt.Errorf("enable raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	selected := min(max(initial, 0), len(items)-1)
+	checked := make([]bool, len(items))
+	buf := make([]byte, 3)
+
+	help := "Use arrow keys to navigate, Enter to select, q to quit."
+	if multi {
+		help = "Use arrow keys to navigate, Space to tag, Enter to confirm, q to quit."
+	}
+
+	render := func() {
+		// Move cursor to start and clear from here down
+		fmt.Print("\r\033[J")
+		fmt.Print(title + "\r\n\r\n")
+		for i, item := range items {
+			if multi {
+				box := "[ ]"
+				if checked[i] {
+					box = "[x]"
+				}
+				item = box + " " + item
+			}
+			if i == selected {
+				fmt.Printf("  \033[1;36m> %s\033[0m\r\n", item)
+			} else {
+				fmt.Printf("    %s\r\n", item)
+			}
+		}
+		fmt.Print("\r\n" + help + "\r\n")
+	}
+
+	up := func() {
+		if selected > 0 {
+			selected--
+		}
+	}
+	down := func() {
+		if selected < len(items)-1 {
+			selected++
+		}
+	}
+
+	for {
+		render()
+		// Move cursor back up to top of menu for the next render
+		fmt.Printf("\033[%dA", len(items)+menuChrome)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return 0, nil, fmt.Errorf("read input: %w", err)
+		}
+
+		if n == 1 {
+			switch buf[0] {
+			case 'q', 'Q':
+				// Clear the menu before exiting
+				fmt.Print("\r\033[J")
+				return 0, nil, errMenuCancelled
+			case 13: // Enter
+				fmt.Print("\r\033[J")
+				return selected, checked, nil
+			case ' ':
+				if multi {
+					checked[selected] = !checked[selected]
+				}
+			case 'k', 'K': // vim up
+				up()
+			case 'j', 'J': // vim down
+				down()
+			}
+		} else if n == 3 && buf[0] == 27 && buf[1] == '[' {
+			switch buf[2] {
+			case 'A': // Up arrow
+				up()
+			case 'B': // Down arrow
+				down()
+			}
+		}
+	}
+}
+
+// confirm asks a yes/no question on stdin and reports whether the answer
+// was yes. Anything else, including EOF, counts as no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
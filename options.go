@@ -0,0 +1,349 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// optionalPath is a flag that may be given bare, as --flag, to use a
+// default path, or with a value, as --flag=/path.
+type optionalPath struct {
+	def   string
+	value string
+}
+
+func (p *optionalPath) String() string   { return p.value }
+func (p *optionalPath) IsBoolFlag() bool { return true }
+
+func (p *optionalPath) Set(v string) error {
+	switch v {
+	case "true":
+		p.value = p.def
+	case "false":
+		p.value = ""
+	default:
+		p.value = v
+	}
+	return nil
+}
+
+// options holds everything parsed from the command line for a launch.
+type options struct {
+	distro                 string
+	testMode               bool
+	quiet                  bool
+	verbose                bool
+	eventsJSON             bool
+	seccomp                string
+	name                   string
+	addHosts               stringList
+	detach                 bool
+	restart                string
+	stopTimeout            string
+	saveOnExit             string
+	saveAlways             bool
+	volumeName             string
+	dataVolumes            stringList
+	devices                stringList
+	baseImage              string
+	registryPrefix         string
+	target                 string
+	forceRebuild           bool
+	yes                    bool
+	network                string
+	dns                    stringList
+	dnsSearch              stringList
+	annotations            stringList
+	tmux                   bool
+	mountCwd               optionalPath
+	arch                   string
+	sshAgent               bool
+	dockerSocket           bool
+	multi                  bool
+	copyIn                 stringList
+	envAll                 bool
+	envFile                string
+	noPrompt               bool
+	init                   bool
+	noVolume               bool
+	ephemeralOnVolumeError bool
+	adopt                  bool
+	buildLog               string
+	keepContext            bool
+	explicitPull           bool
+	verifyImage            bool
+	minFree                string
+	context                string
+	tmpDir                 string
+	noTTY                  bool
+	user                   string
+	idleTimeout            string
+	initScript             string
+	runFile                string
+	ignoreInitErrors       bool
+	userNS                 string
+	pid                    string
+	ipc                    string
+	cgroupParent           string
+	gpus                   string
+	tz                     string
+	hostZoneinfo           bool
+	selinuxLabel           string
+	command                []string
+	flagArgs               []string // the flags as given, for replaying the launch
+
+	memory            string
+	memoryReservation string
+	oomKillDisable    bool
+	oomScoreAdj       string
+	ulimits           stringList
+	cpus              string
+	cpusetCPUs        string
+	cpusetMems        string
+}
+
+// parseArgs parses a launch command line. Flags may appear before or after
+// the distro name, e.g. "ubuntu --test" and "--test ubuntu" are equivalent.
+// Anything after "--" is a command to run in the container instead of the
+// interactive shell.
+func parseArgs(args []string) (*options, error) {
+	opts := &options{mountCwd: optionalPath{def: "/work"}}
+
+	if i := slices.Index(args, "--"); i >= 0 {
+		opts.command = args[i+1:]
+		args = args[:i]
+	}
+
+	fs := flag.NewFlagSet("linuxformac", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.testMode, "test", false, "allow running on a Linux host")
+	fs.BoolVar(&opts.quiet, "quiet", false, "print plain log lines instead of progress output, and hide build output")
+	fs.BoolVar(&opts.verbose, "verbose", false, "log source locations and the exact runtime commands")
+	fs.BoolVar(&opts.eventsJSON, "events-json", false, "write lifecycle events to stderr as newline-delimited JSON for other tools")
+	fs.StringVar(&opts.name, "name", "", "name for the container")
+	fs.BoolVar(&opts.detach, "detach", false, "run the container in the background")
+	fs.BoolVar(&opts.detach, "d", false, "shorthand for --detach")
+	fs.StringVar(&opts.restart, "restart", "", "restart policy for detached containers: no, on-failure[:N], always, unless-stopped")
+	fs.StringVar(&opts.saveOnExit, "save-on-exit", "", "when the session ends on its own (not killed, out of memory or stopped when idle), commit the container to this image tag")
+	fs.BoolVar(&opts.saveAlways, "save-always", false, "with --save-on-exit, also save a session that was killed or stopped")
+	fs.StringVar(&opts.stopTimeout, "stop-timeout", "", "seconds a stop waits for the container to exit before killing it")
+	fs.BoolVar(&opts.noVolume, "no-volume", false, "do not create or mount a persistent /data volume")
+	fs.BoolVar(&opts.ephemeralOnVolumeError, "ephemeral-on-volume-error", false, "run without /data instead of failing when the volume cannot be created")
+	fs.Var(&opts.mountCwd, "mount-cwd", "bind-mount the current directory at /work, or at --mount-cwd=/path, and start there")
+	fs.Var(&opts.dataVolumes, "data-volume", "mount an extra persistent volume as name:/mountpoint (repeatable)")
+	fs.BoolVar(&opts.adopt, "adopt", false, "mount an existing volume directory without the linuxformac marker, e.g. a --volume-name or --data-volume one from an older version")
+	fs.StringVar(&opts.volumeName, "volume-name", "", "mount the <name>_Volume volume at /data instead of <distro>_Volume")
+	fs.StringVar(&opts.user, "user", "", "run as this image user or uid[:gid] instead of a copy of the host user")
+	fs.StringVar(&opts.initScript, "init-script", "", "script to run in the container as the user before the shell starts")
+	fs.BoolVar(&opts.ignoreInitErrors, "ignore-init-errors", false, "start the shell even if --init-script fails")
+	fs.StringVar(&opts.idleTimeout, "idle-timeout", "", "stop the container after this long without keyboard input, e.g. 30m")
+	fs.BoolVar(&opts.noTTY, "no-tty", false, "run without -i/-t; implied when stdin or stdout is not a terminal")
+	fs.StringVar(&opts.minFree, "min-free", defaultMinFree, "free disk space required before building an image; 0 disables the check")
+	fs.StringVar(&opts.tmpDir, "tmp-dir", "", "directory for the temporary build context (default $LINUXFORMAC_TMPDIR, then the cache dir)")
+	fs.StringVar(&opts.context, "context", "", "directory whose files are added to the image build context")
+	fs.StringVar(&opts.runFile, "run-file", "", "feed this shell script to the container non-interactively and exit with its status")
+	fs.BoolVar(&opts.verifyImage, "verify-image", false, "start the image with a no-op command before launching to catch a damaged image")
+	fs.BoolVar(&opts.explicitPull, "explicit-pull", false, "pull the base image with its own progress output before building")
+	fs.BoolVar(&opts.keepContext, "keep-context", false, "do not delete the temporary build context, and log where it is")
+	fs.StringVar(&opts.buildLog, "build-log", "", "also write image build output to this file")
+	fs.StringVar(&opts.baseImage, "base-image", "", "override the distro's base image when building")
+	fs.StringVar(&opts.registryPrefix, "registry-prefix", "", "pull docker.io base images through this registry mirror, e.g. mirror.example.com (default registry_prefix in config.json)")
+	fs.StringVar(&opts.target, "target", "", "build this stage of a multi-stage Dockerfile, e.g. base for a minimal or dev for a toolchain ubuntu image")
+	fs.StringVar(&opts.arch, "arch", "", "build and run the image for amd64 or arm64, emulating a foreign architecture")
+	fs.BoolVar(&opts.yes, "yes", false, "build missing images without asking to confirm the download")
+	fs.BoolVar(&opts.forceRebuild, "force-rebuild", false, "rebuild the image even if it already exists")
+	fs.BoolVar(&opts.sshAgent, "ssh-agent", false, "forward the host SSH agent into the container")
+	fs.BoolVar(&opts.dockerSocket, "docker-socket", false, "mount the host container API socket at /var/run/docker.sock")
+	fs.BoolVar(&opts.multi, "multi", false, "tag several distros in the menu and build their images in parallel")
+	fs.Var(&opts.copyIn, "copy-in", "copy a host file into the container before it starts, as host:container (repeatable)")
+	fs.BoolVar(&opts.envAll, "env-all", false, "pass the host environment (minus PATH, HOME, etc.) into the container; this includes any secrets in it")
+	fs.StringVar(&opts.envFile, "env-file", "", "pass KEY=VALUE lines from a file into the container")
+	fs.BoolVar(&opts.tmux, "tmux", false, "start the shell in a tmux session named after the container, which attach rejoins (needs tmux in the image)")
+	fs.BoolVar(&opts.noPrompt, "no-prompt", false, "do not add the colored distro tag to the shell prompt")
+	fs.BoolVar(&opts.init, "init", false, "run an init process as PID 1 that reaps zombies and forwards signals to the shell (default for --detach)")
+	fs.StringVar(&opts.memory, "memory", "", "hard memory limit, e.g. 4g")
+	fs.StringVar(&opts.memoryReservation, "memory-reservation", "", "soft memory limit reclaimed to under host pressure; must not exceed --memory")
+	fs.BoolVar(&opts.oomKillDisable, "oom-kill-disable", false, "do not OOM-kill the container (requires --memory)")
+	fs.StringVar(&opts.oomScoreAdj, "oom-score-adj", "", "OOM killer preference from -1000 to 1000")
+	fs.StringVar(&opts.tz, "tz", "", "container timezone such as America/New_York (default the host's)")
+	fs.BoolVar(&opts.hostZoneinfo, "host-zoneinfo", false, "bind-mount the host's zoneinfo database read-only instead of the image's")
+	fs.StringVar(&opts.selinuxLabel, "selinux-label", "", "SELinux relabeling of bind mounts: z (shared), Z (private) or none (default z for volumes when SELinux is enforcing; the --mount-cwd directory only when given)")
+	fs.StringVar(&opts.userNS, "userns", "", "user namespace mode: host, or keep-id (podman only) to map your uid into the container")
+	fs.StringVar(&opts.pid, "pid", "", "PID namespace to join: host or container:<name>")
+	fs.StringVar(&opts.ipc, "ipc", "", "IPC namespace mode: none, private, shareable, host or container:<name>")
+	fs.StringVar(&opts.cgroupParent, "cgroup-parent", "", "parent cgroup: a systemd slice such as machine-dev.slice, or a cgroupfs path such as /linuxformac")
+	fs.StringVar(&opts.gpus, "gpus", "", "GPUs to expose: all, or indices such as 0,1")
+	fs.StringVar(&opts.cpus, "cpus", "", "number of CPUs the container may use, e.g. 2 or 1.5")
+	fs.StringVar(&opts.cpusetCPUs, "cpuset-cpus", "", "pin the container to these CPUs, e.g. 0-3 or 0,2 (on macOS, CPUs of the podman machine)")
+	fs.StringVar(&opts.cpusetMems, "cpuset-mems", "", "restrict the container's memory to these NUMA nodes, e.g. 0 or 0-1")
+	fs.Var(&opts.ulimits, "ulimit", "resource limit as name=soft[:hard], e.g. nofile=4096:8192 (repeatable)")
+	fs.Var(&opts.devices, "device", "host device to pass through as host[:container[:perms]] (repeatable)")
+	fs.Var(&opts.annotations, "annotation", "OCI annotation as key=value (repeatable; a label under docker)")
+	fs.StringVar(&opts.network, "network", "", "connect the container to this network")
+	fs.Var(&opts.dns, "dns", "DNS server IP for the container (repeatable)")
+	fs.Var(&opts.dnsSearch, "dns-search", "DNS search domain for the container (repeatable)")
+	fs.Var(&opts.addHosts, "add-host", "extra /etc/hosts entry as name:ip (repeatable)")
+	fs.StringVar(&opts.seccomp, "seccomp", "", "seccomp profile path, or \"unconfined\"")
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		opts.flagArgs = append(opts.flagArgs, args[:len(args)-len(fs.Args())]...)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) > 1 {
+		return nil, fmt.Errorf("unexpected arguments: %v", positional[1:])
+	}
+	if len(positional) == 1 {
+		opts.distro = positional[0]
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	// Detached containers run for a long time, so reap zombies by default
+	if opts.detach && !set["init"] {
+		opts.init = true
+	}
+	return opts, nil
+}
+
+// validateAddHost checks a name:ip host entry. The IP may be IPv6, so only
+// the first colon separates the name; "host-gateway" is passed through.
+func validateAddHost(entry string) error {
+	name, ip, ok := strings.Cut(entry, ":")
+	if !ok || name == "" || ip == "" {
+		return fmt.Errorf("invalid host entry %q: want name:ip", entry)
+	}
+	if ip != "host-gateway" && net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid host entry %q: %q is not an IP address", entry, ip)
+	}
+	return nil
+}
+
+var annotationKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+
+// validateAnnotation checks a key=value annotation.
+func validateAnnotation(spec string) error {
+	key, _, ok := strings.Cut(spec, "=")
+	if !ok || !annotationKey.MatchString(key) {
+		return fmt.Errorf("invalid annotation %q: want key=value with a key such as org.example.team", spec)
+	}
+	return nil
+}
+
+// validateDNS checks that a --dns value is an IP address.
+func validateDNS(server string) error {
+	if net.ParseIP(server) == nil {
+		return fmt.Errorf("%q is not an IP address", server)
+	}
+	return nil
+}
+
+var searchDomain = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.)*[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?\.?$`)
+
+// validateDNSSearch checks that a --dns-search value is a domain name.
+func validateDNSSearch(domain string) error {
+	if len(domain) > 253 || !searchDomain.MatchString(domain) {
+		return fmt.Errorf("%q is not a domain name", domain)
+	}
+	return nil
+}
+
+// validateRestartPolicy checks a --restart value against the policies both
+// docker and podman understand.
+func validateRestartPolicy(policy string) error {
+	switch policy {
+	case "no", "on-failure", "always", "unless-stopped":
+		return nil
+	}
+	if retries, ok := strings.CutPrefix(policy, "on-failure:"); ok {
+		if n, err := strconv.Atoi(retries); err == nil && n >= 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown policy %q (want no, on-failure[:N], always, unless-stopped)", policy)
+}
+
+// validateDevice checks a host[:container[:perms]] device mapping and that
+// the host device exists.
+func validateDevice(spec string) error {
+	host, _, _ := strings.Cut(spec, ":")
+	if !strings.HasPrefix(host, "/dev/") {
+		return fmt.Errorf("invalid device %q: host path must be under /dev", spec)
+	}
+	if _, err := os.Stat(host); err != nil {
+		return fmt.Errorf("device %s: %w", host, err)
+	}
+	return nil
+}
+
+// imageRef loosely matches [registry[:port]/]path[:tag][@digest].
+var imageRef = regexp.MustCompile(`^[a-zA-Z0-9]+([._-][a-zA-Z0-9]+)*(:[0-9]+)?(/[a-z0-9]+([._-]+[a-z0-9]+)*)*(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+
+// validateImageRef checks that ref looks like an image reference.
+func validateImageRef(ref string) error {
+	if !imageRef.MatchString(ref) {
+		return fmt.Errorf("%q is not a valid image reference", ref)
+	}
+	return nil
+}
+
+// flagErrors collects the problems found while validating launch flags, so
+// that a typo is reported together with every other one instead of after
+// the first is fixed.
+type flagErrors []string
+
+// add records a problem described by a format string.
+func (e *flagErrors) add(format string, args ...any) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+// check records err, if any, as a problem with flag.
+func (e *flagErrors) check(flag string, err error) {
+	if err != nil {
+		e.add("Invalid %s: %v", flag, err)
+	}
+}
+
+// exitIfAny reports every recorded problem and exits if there were any.
+func (e flagErrors) exitIfAny() {
+	if len(e) == 0 {
+		return
+	}
+	for _, msg := range e {
+		log.Print(msg)
+	}
+	log.Fatalf("%d invalid option(s); nothing was built or started.", len(e))
+}
+
+// Error lists every recorded problem, one per line.
+func (e flagErrors) Error() string {
+	return fmt.Sprintf("%s\n%d invalid option(s); nothing was built or started.", strings.Join(e, "\n"), len(e))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// overlayDir returns the directory whose files are copied into the home
+// directory of distro's containers.
+func overlayDir(distro string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "overlay", distro), nil
+}
+
+// addOverlay copies the distro's overlay directory, if any, to overlay/ in
+// the build context. The Dockerfiles copy it to /etc/linuxformac/overlay,
+// from which the entrypoint fills in the user's home without replacing
+// existing files. The directory is always created so the COPY has a source.
+// Symlinks must stay inside the overlay, since they are resolved in the
+// image.
+func addOverlay(buildCtx, distro string) error {
+	dest := filepath.Join(buildCtx, "overlay")
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+
+	src, err := overlayDir(distro)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", src)
+	}
+	log.Printf("Adding overlay from %s", src)
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			resolved := filepath.Join(filepath.Dir(rel), link)
+			if filepath.IsAbs(link) || resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("overlay symlink %s points outside the overlay (%s)", rel, link)
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target)
+		}
+		log.Printf("Skipping overlay entry %s: not a file, directory or symlink", rel)
+		return nil
+	})
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// planInputs are the host-side facts a run plan is assembled from. Getting
+// them may have side effects, such as building the image or creating
+// volumes, which is left to the caller.
+type planInputs struct {
+	runtime     string
+	image       string
+	user        string // sanitized host user name
+	uid         string
+	gid         string
+	volume      string   // host directory mounted at /data, or ""
+	dataVolumes []string // host:target mounts from --data-volume
+	cwd         string   // host:target mount from --mount-cwd, or ""
+	seccomp     string   // resolved profile path, "unconfined" or ""
+	relabel     string   // SELinux mount option, "z" or "Z", or ""
+	env         []string // passed-through KEY=VALUE pairs
+	resources   []string // memory and CPU limit flags
+	name        string
+	headless    bool
+}
+
+// runFileCommand runs the --run-file script from stdin with bash, which
+// every image has for the entrypoint. Sourcing it keeps heredocs and line
+// numbers intact, and under set -e the ERR trap names the failing line.
+var runFileCommand = []string{"bash", "-c",
+	`trap 's=$?; case $- in *e*) echo "run-file: line $LINENO: exit status $s" >&2;; esac' ERR; . /dev/stdin`}
+
+// buildRunPlan turns the launch options and the resolved host facts into
+// the runtime-independent description of the container to run.
+func buildRunPlan(opts *options, in planInputs) (*runSpec, error) {
+	distro := opts.distro
+	spec := &runSpec{
+		Image:     in.image,
+		Hostname:  distro,
+		Name:      in.name,
+		TTY:       !in.headless || opts.detach,
+		Detach:    opts.detach,
+		Restart:   opts.restart,
+		Keep:      opts.saveOnExit != "",
+		Network:   opts.network,
+		Init:      opts.init,
+		StopWait:  opts.stopTimeout,
+		UserNS:    opts.userNS,
+		PID:       opts.pid,
+		IPC:       opts.ipc,
+		Cgroup:    opts.cgroupParent,
+		GPUs:      opts.gpus,
+		Labels:    []string{labelDistro + "=" + distro},
+		Env:       []string{"DISTRO_TYPE=" + distro},
+		Annotate:  opts.annotations,
+		Devices:   opts.devices,
+		Ulimits:   opts.ulimits,
+		AddHosts:  opts.addHosts,
+		DNS:       opts.dns,
+		DNSSearch: opts.dnsSearch,
+		Extra:     in.resources,
+		Command:   opts.command,
+	}
+	if opts.arch != "" {
+		spec.Platform = "linux/" + opts.arch
+	}
+	if opts.runFile != "" {
+		spec.Stdin = true
+		spec.Command = runFileCommand
+	} else if !spec.TTY {
+		log.Println("No TTY: running without -it.")
+	}
+	if opts.user != "" {
+		// The entrypoint cannot create users without root, so it skips
+		// straight to the shell
+		log.Printf("Running as --user %s instead of the host user.", opts.user)
+		spec.User = opts.user
+		spec.Env = append(spec.Env, "LINUXFORMAC_SKIP_USER=1")
+		if runtime.GOOS == "darwin" {
+			log.Printf("WARNING: the mounted home is owned by uid %s; %s may not be able to write to it.", in.uid, opts.user)
+		}
+	} else {
+		spec.Env = append(spec.Env,
+			"HOST_USER="+in.user,
+			"HOST_UID="+in.uid,
+			"HOST_GID="+in.gid,
+		)
+	}
+
+	// Only the directories linuxformac mounts for the user are relabeled;
+	// relabeling system files such as the zoneinfo database or the agent
+	// sockets would change them for the host too
+	bind := func(mount string) string {
+		if in.relabel == "" {
+			return mount
+		}
+		return mount + ":" + in.relabel
+	}
+	if in.volume != "" {
+		spec.Mounts = append(spec.Mounts, bind(in.volume+":/data"))
+		spec.Labels = append(spec.Labels, labelVolume+"="+in.volume)
+	}
+	for _, m := range in.dataVolumes {
+		spec.Mounts = append(spec.Mounts, bind(m))
+	}
+
+	if in.cwd != "" {
+		log.Printf("Mounting %s", in.cwd)
+		// Relabeling is recursive and the working directory could be
+		// anything, even the home directory, so it takes an explicit flag
+		if opts.selinuxLabel != "" {
+			spec.Mounts = append(spec.Mounts, bind(in.cwd))
+		} else {
+			if in.relabel != "" {
+				log.Println("WARNING: SELinux is enforcing but the --mount-cwd directory is not relabeled; if access is denied, pass --selinux-label z to relabel it.")
+			}
+			spec.Mounts = append(spec.Mounts, in.cwd)
+		}
+		spec.Workdir = filepath.Clean(opts.mountCwd.value)
+		spec.Env = append(spec.Env, "LINUXFORMAC_WORKDIR="+spec.Workdir)
+	}
+
+	if opts.hostZoneinfo {
+		spec.Mounts = append(spec.Mounts, hostZoneinfo+":"+hostZoneinfo+":ro")
+	}
+
+	if in.seccomp != "" {
+		spec.Security = append(spec.Security, "seccomp="+in.seccomp)
+	}
+
+	if runtime.GOOS == "darwin" {
+		home, err := os.UserHomeDir()
+		if err == nil && in.user != "" {
+			spec.Mounts = append(spec.Mounts, home+":/home/"+in.user)
+		}
+	}
+
+	if opts.tmux {
+		// tmux does not allow . or : in session names
+		session := strings.NewReplacer(".", "_", ":", "_").Replace(in.name)
+		spec.Env = append(spec.Env, "LINUXFORMAC_TMUX="+session)
+	}
+
+	spec.Env = append(spec.Env, passedEnv(in.env)...)
+
+	if opts.dockerSocket {
+		mount, err := dockerSocketMount(in.runtime)
+		if err != nil {
+			return nil, fmt.Errorf("cannot mount the container socket: %w", err)
+		}
+		log.Println("WARNING: --docker-socket gives the container full control of the host's container runtime, which is equivalent to root on the host.")
+		spec.Mounts = append(spec.Mounts, mount)
+	}
+
+	if opts.sshAgent {
+		mount, err := sshAgentMount(in.runtime)
+		if err != nil {
+			log.Printf("WARNING: not forwarding SSH agent: %v", err)
+		} else {
+			spec.Mounts = append(spec.Mounts, mount)
+			spec.Env = append(spec.Env, "SSH_AUTH_SOCK="+containerSSHSock)
+		}
+	}
+	return spec, nil
+}
+
+// launchEnv returns the KEY=VALUE pairs to pass into the container from
+// --env-all, --env-file, --tz, the prompt tag and --init-script.
+func launchEnv(opts *options) ([]string, error) {
+	var env []string
+	if opts.envAll {
+		env = append(env, hostEnv()...)
+	}
+	if opts.envFile != "" {
+		vars, err := readEnvFile(opts.envFile)
+		if err != nil {
+			return nil, fmt.Errorf("--env-file: %w", err)
+		}
+		env = append(env, vars...)
+	}
+
+	tz := opts.tz
+	if tz == "" {
+		tz = hostTimezone()
+		if tz != "" && validateTimezone(tz) != nil {
+			tz = ""
+		}
+	} else if err := validateTimezone(tz); err != nil {
+		return nil, fmt.Errorf("--tz: %w", err)
+	}
+	if tz != "" {
+		env = append(env, "TZ="+tz)
+	}
+
+	if !opts.noPrompt {
+		// The hostname is the distro, so the tag names both
+		env = append(env,
+			"LINUXFORMAC_PROMPT="+opts.distro,
+			"LINUXFORMAC_PROMPT_COLOR="+distroPromptColor[opts.distro],
+		)
+	}
+
+	if opts.initScript != "" {
+		env = append(env, "LINUXFORMAC_INIT_SCRIPT="+containerInitScript)
+		if opts.ignoreInitErrors {
+			env = append(env, "LINUXFORMAC_IGNORE_INIT_ERRORS=1")
+		}
+	}
+	return env, nil
+}
+
+// currentDir returns the absolute working directory after checking that it
+// can be listed.
+func currentDir() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if cwd, err = filepath.Abs(cwd); err != nil {
+		return "", err
+	}
+	dir, err := os.Open(cwd)
+	if err == nil {
+		_, err = dir.Readdirnames(1)
+		dir.Close()
+	}
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("%s is not readable: %w", cwd, err)
+	}
+	return cwd, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// progress reports which phase of a multi-step launch is running.
+// On a terminal it draws a small bar; otherwise it falls back to log lines.
+type progress struct {
+	total int
+	step  int
+	fancy bool
+}
+
+func newProgress(total int, quiet bool) *progress {
+	return &progress{
+		total: total,
+		fancy: !quiet && term.IsTerminal(int(os.Stdout.Fd())),
+	}
+}
+
+// Step advances to the next phase and announces it.
+func (p *progress) Step(msg string) {
+	if p.step < p.total {
+		p.step++
+	}
+
+	if !p.fancy {
+		log.Printf("[%d/%d] %s", p.step, p.total, msg)
+		return
+	}
+
+	const width = 20
+	filled := width * p.step / p.total
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+	fmt.Printf("\033[1;36m[%d/%d]\033[0m %s %s\n", p.step, p.total, bar, msg)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// projectFile is the per-directory launch file, e.g.
+//
+//	# .linuxformac
+//	ubuntu --mount-cwd --ssh-agent
+//
+// It holds a distro and launch flags separated by whitespace, over any
+// number of lines; values cannot contain spaces.
+const projectFile = ".linuxformac"
+
+// loadProjectArgs returns the arguments in the current directory's project
+// file and its path, or nil if there is no such file.
+func loadProjectArgs() ([]string, string, error) {
+	path, err := filepath.Abs(projectFile)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var args []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args = append(args, strings.Fields(line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", fmt.Errorf("read %s: %w", path, err)
+	}
+	return args, path, nil
+}
+
+// applyProjectFile re-parses the command line with the project file's
+// arguments in front of cliArgs, so flags given on the command line win
+// over the file's (repeatable flags from both are combined). It returns
+// nil options when there is no project file.
+func applyProjectFile(cliArgs []string) (*options, error) {
+	fileArgs, path, err := loadProjectArgs()
+	if err != nil || fileArgs == nil {
+		return nil, err
+	}
+	if slices.Contains(fileArgs, "--") {
+		return nil, fmt.Errorf("%s: a command after -- belongs on the command line", path)
+	}
+
+	// A command after "--" on the command line stays last
+	opts, err := parseArgs(append(fileArgs, cliArgs...))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if opts.distro == "" {
+		return nil, fmt.Errorf("%s does not name a distro", path)
+	}
+	if _, ok := distroPath[opts.distro]; !ok {
+		return nil, fmt.Errorf("%s: unknown distro %q (supported: ubuntu, arch, fedora, debian, alpine)", path, opts.distro)
+	}
+	fmt.Println("Using", path)
+	return opts, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultRegistry is the registry the embedded Dockerfiles pull from.
+const defaultRegistry = "docker.io"
+
+var validRegistryPrefix = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+
+// validateRegistryPrefix checks a registry mirror: a host, optional port and
+// optional path, e.g. mirror.example.com:5000/dockerhub, without a scheme.
+func validateRegistryPrefix(prefix string) error {
+	if !validRegistryPrefix.MatchString(prefix) {
+		return fmt.Errorf("invalid registry %q: want host[:port][/path] without a scheme", prefix)
+	}
+	return nil
+}
+
+// resolveRegistryPrefix returns the --registry-prefix value, or else the
+// registry_prefix from the config file.
+func resolveRegistryPrefix(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, validateRegistryPrefix(flagValue)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	if cfg.RegistryPrefix == "" {
+		return "", nil
+	}
+	if err := validateRegistryPrefix(cfg.RegistryPrefix); err != nil {
+		return "", fmt.Errorf("registry_prefix: %w", err)
+	}
+	return cfg.RegistryPrefix, nil
+}
+
+// withRegistryPrefix points a docker.io reference at the mirror prefix.
+// References to other registries are left alone.
+func withRegistryPrefix(ref, prefix string) string {
+	if prefix == "" {
+		return ref
+	}
+	if rest, ok := strings.CutPrefix(ref, defaultRegistry+"/"); ok {
+		return prefix + "/" + rest
+	}
+	return ref
+}
+
+// registryOf returns the registry host a reference is pulled from, for
+// telling the user where to log in.
+func registryOf(ref string) string {
+	host, _, ok := strings.Cut(ref, "/")
+	if !ok || !(strings.ContainsAny(host, ".:") || host == "localhost") {
+		return defaultRegistry
+	}
+	return host
+}
+
+// authFailurePatterns are runtime errors that mean the registry refused
+// the pull for lack of, or wrong, credentials.
+var authFailurePatterns = []string{
+	"unauthorized",
+	"authentication required",
+	"denied: requested access",
+	"pull access denied",
+	"401 unauthorized",
+	"403 forbidden",
+	"no basic auth credentials",
+}
+
+// looksUnauthorized reports whether runtime error output points at a
+// registry authentication failure.
+func looksUnauthorized(output string) bool {
+	output = strings.ToLower(output)
+	for _, p := range authFailurePatterns {
+		if strings.Contains(output, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginHint tells the user how to authenticate for ref. Builds and pulls
+// use the runtime's stored credentials, so a login is all that is needed.
+func loginHint(containerRuntime, ref string) string {
+	return fmt.Sprintf("the registry refused to serve %s; run `%s login %s` and try again", ref, containerRuntime, registryOf(ref))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sizePattern = regexp.MustCompile(`^(\d+)(?:([kmg])(?:i?b)?|b)?$`)
+
+// parseSize parses a docker-style size such as 512m, 4g, 4gb or 512MiB into
+// bytes. Like docker and podman, it treats every unit as a power of 1024.
+func parseSize(s string) (int64, error) {
+	m := sizePattern.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q: want a number with optional b, k, m or g suffix, e.g. 512m, 4gb or 4GiB", s)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	switch m[2] {
+	case "k":
+		n <<= 10
+	case "m":
+		n <<= 20
+	case "g":
+		n <<= 30
+	}
+	return n, nil
+}
+
+// memoryArgs validates the memory flags and returns the matching run
+// arguments. --memory is the hard limit the container is killed at;
+// --memory-reservation is a soft limit the kernel reclaims down to under
+// host memory pressure, so it must not exceed the hard limit.
+func memoryArgs(opts *options) ([]string, error) {
+	var args []string
+	var limit int64
+	if opts.memory != "" {
+		n, err := parseSize(opts.memory)
+		if err != nil {
+			return nil, fmt.Errorf("--memory: %w", err)
+		}
+		limit = n
+		args = append(args, "--memory", opts.memory)
+	}
+	if opts.memoryReservation != "" {
+		n, err := parseSize(opts.memoryReservation)
+		if err != nil {
+			return nil, fmt.Errorf("--memory-reservation: %w", err)
+		}
+		if limit > 0 && n > limit {
+			return nil, fmt.Errorf("--memory-reservation %s exceeds --memory %s", opts.memoryReservation, opts.memory)
+		}
+		args = append(args, "--memory-reservation", opts.memoryReservation)
+	}
+	if opts.oomKillDisable {
+		if limit == 0 {
+			return nil, fmt.Errorf("--oom-kill-disable needs --memory, or an out-of-memory container could hang the host")
+		}
+		args = append(args, "--oom-kill-disable")
+	}
+	if opts.oomScoreAdj != "" {
+		n, err := strconv.Atoi(opts.oomScoreAdj)
+		if err != nil || n < -1000 || n > 1000 {
+			return nil, fmt.Errorf("--oom-score-adj must be an integer from -1000 to 1000, got %q", opts.oomScoreAdj)
+		}
+		args = append(args, "--oom-score-adj", opts.oomScoreAdj)
+	}
+	return args, nil
+}
+
+// cpuArgs validates --cpus, --cpuset-cpus and --cpuset-mems and returns
+// the matching run arguments.
+func cpuArgs(opts *options) ([]string, error) {
+	var args []string
+	if opts.cpus != "" {
+		n, err := strconv.ParseFloat(opts.cpus, 64)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("--cpus must be a positive number such as 2 or 1.5, got %q", opts.cpus)
+		}
+		args = append(args, "--cpus", opts.cpus)
+	}
+	if opts.cpusetCPUs != "" {
+		if _, err := cpuListMax(opts.cpusetCPUs); err != nil {
+			return nil, fmt.Errorf("--cpuset-cpus: %w", err)
+		}
+		args = append(args, "--cpuset-cpus", opts.cpusetCPUs)
+	}
+	if opts.cpusetMems != "" {
+		if _, err := cpuListMax(opts.cpusetMems); err != nil {
+			return nil, fmt.Errorf("--cpuset-mems: %w", err)
+		}
+		args = append(args, "--cpuset-mems", opts.cpusetMems)
+	}
+	return args, nil
+}
+
+// cpuListMax parses a kernel cpu list such as 0-3,6 and returns the
+// highest index in it.
+func cpuListMax(list string) (int, error) {
+	highest := -1
+	for _, part := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		if !isRange {
+			hi = lo
+		}
+		first, err1 := strconv.Atoi(lo)
+		last, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || first < 0 || last < first {
+			return 0, fmt.Errorf("invalid list %q: want indices and ranges such as 0-3,6", list)
+		}
+		highest = max(highest, last)
+	}
+	return highest, nil
+}
+
+// warnMachineResources warns when --memory, --cpus or --cpuset-cpus asks
+// for more than the podman machine VM has. On macOS every container runs
+// inside that VM, so a larger limit is never reached and the container is
+// OOM-killed or starved well before it.
+func warnMachineResources(opts *options) {
+	out, err := exec.Command("podman", "machine", "inspect", "--format", "{{.Resources.CPUs}} {{.Resources.Memory}}").Output()
+	if err != nil {
+		debugf("Cannot inspect the podman machine: %v", err)
+		return
+	}
+	var cpus float64
+	var memMiB int64
+	if _, err := fmt.Sscan(string(out), &cpus, &memMiB); err != nil {
+		debugf("Cannot parse podman machine resources %q: %v", out, err)
+		return
+	}
+
+	if opts.memory != "" {
+		if want, err := parseSize(opts.memory); err == nil && want > memMiB<<20 {
+			log.Printf("WARNING: --memory %s exceeds the podman machine's %s; raise it with `podman machine stop && podman machine set --memory %d && podman machine start`.",
+				opts.memory, formatBytes(memMiB<<20), (want+(1<<20)-1)>>20)
+		}
+	}
+	if opts.cpus != "" {
+		if want, err := strconv.ParseFloat(opts.cpus, 64); err == nil && want > cpus {
+			log.Printf("WARNING: --cpus %s exceeds the podman machine's %g CPUs; raise it with `podman machine stop && podman machine set --cpus N && podman machine start`.",
+				opts.cpus, cpus)
+		}
+	}
+	if opts.cpusetCPUs != "" {
+		// The machine's CPUs are numbered from 0 inside its VM
+		if highest, err := cpuListMax(opts.cpusetCPUs); err == nil && float64(highest) >= cpus {
+			log.Printf("WARNING: --cpuset-cpus %s names CPU %d, but the podman machine only has CPUs 0-%d; raise it with `podman machine stop && podman machine set --cpus N && podman machine start`.",
+				opts.cpusetCPUs, highest, int(cpus)-1)
+		}
+	}
+}
+
+// ulimitNames are the limits both runtimes accept for --ulimit. Both apply
+// them with setrlimit in the container, with these differences:
+//   - rootless podman cannot raise a hard limit above the invoking user's
+//     own, so large nofile or memlock values fail at start;
+//   - docker applies nproc per user across all containers, not per
+//     container, because the kernel counts processes per uid.
+var ulimitNames = map[string]bool{
+	"core": true, "cpu": true, "data": true, "fsize": true, "locks": true,
+	"memlock": true, "msgqueue": true, "nice": true, "nofile": true,
+	"nproc": true, "rss": true, "rtprio": true, "rttime": true,
+	"sigpending": true, "stack": true,
+}
+
+// validateUlimit checks a name=soft[:hard] ulimit, where -1 is unlimited.
+func validateUlimit(spec string) error {
+	name, limits, ok := strings.Cut(spec, "=")
+	if !ok || !ulimitNames[name] {
+		return fmt.Errorf("invalid ulimit %q: want name=soft[:hard] with a name such as nofile or nproc", spec)
+	}
+	soft, hard, hasHard := strings.Cut(limits, ":")
+	s, err := strconv.ParseInt(soft, 10, 64)
+	if err != nil || s < -1 {
+		return fmt.Errorf("invalid ulimit %q: soft limit must be a number or -1", spec)
+	}
+	if !hasHard {
+		return nil
+	}
+	h, err := strconv.ParseInt(hard, 10, 64)
+	if err != nil || h < -1 {
+		return fmt.Errorf("invalid ulimit %q: hard limit must be a number or -1", spec)
+	}
+	if h != -1 && (s == -1 || s > h) {
+		return fmt.Errorf("invalid ulimit %q: soft limit exceeds hard limit", spec)
+	}
+	return nil
+}
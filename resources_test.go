@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"4", 4, true},
+		{"1024", 1024, true},
+		{"100b", 100, true},
+		{"512k", 512 << 10, true},
+		{"512m", 512 << 20, true},
+		{"4g", 4 << 30, true},
+		{"4G", 4 << 30, true},
+		{"4gb", 4 << 30, true},
+		{"4GB", 4 << 30, true},
+		{"4GiB", 4 << 30, true},
+		{"512MiB", 512 << 20, true},
+		{"64kib", 64 << 10, true},
+		{"", 0, false},
+		{"4ib", 0, false},
+		{"4t", 0, false},
+		{"1.5g", 0, false},
+		{"-1g", 0, false},
+		{"g", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseSize(%q) error = %v, want ok = %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
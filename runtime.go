@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Runtime is the container CLI in use. Docker and podman accept mostly the
+// same run flags, but not all of them; RunArgs is the one place that knows
+// the differences.
+type Runtime struct {
+	Name string
+}
+
+// IsPodman reports whether the runtime is podman.
+func (rt Runtime) IsPodman() bool { return rt.Name == "podman" }
+
+// runSpec describes a container launch independently of the runtime that
+// will perform it.
+type runSpec struct {
+	Image     string
+	Hostname  string
+	Platform  string // e.g. linux/amd64; empty for the host's
+	Name      string
+	Network   string
+	TTY       bool
+	Stdin     bool // keep stdin open without a TTY
+	Detach    bool
+	Restart   string // empty removes the container on exit
+	Keep      bool   // do not remove the container on exit
+	Init      bool
+	StopWait  string // seconds before stop kills the container, or ""
+	User      string
+	Workdir   string
+	UserNS    string // "", "host" or "keep-id"
+	PID       string
+	IPC       string
+	Cgroup    string // --cgroup-parent, or ""
+	GPUs      string // "", "all" or a comma-separated list of indices
+	Labels    []string
+	Annotate  []string // OCI annotations as key=value
+	Env       []string // KEY=VALUE; only the keys go on the command line
+	Mounts    []string // host:container
+	Devices   []string
+	Ulimits   []string
+	AddHosts  []string
+	DNS       []string
+	DNSSearch []string
+	Security  []string // --security-opt values
+	Extra     []string // flags both runtimes spell the same, e.g. memory limits
+	Command   []string
+}
+
+// RunEnv returns the environment to run the runtime with, so that the bare
+// `-e KEY` flags from RunArgs pick up spec's values.
+func (rt Runtime) RunEnv(spec *runSpec) []string {
+	return append(os.Environ(), spec.Env...)
+}
+
+// RunArgs translates spec into the arguments for `<runtime> run`.
+func (rt Runtime) RunArgs(spec *runSpec) ([]string, error) {
+	args := []string{"run"}
+	if spec.TTY {
+		args = append(args, "-it")
+	} else if spec.Stdin {
+		args = append(args, "-i")
+	}
+	if spec.Detach {
+		args = append(args, "-d")
+	}
+	if spec.Restart != "" {
+		args = append(args, "--restart", spec.Restart)
+	} else if !spec.Keep {
+		args = append(args, "--rm")
+	}
+	if spec.Platform != "" {
+		args = append(args, "--platform", spec.Platform)
+	}
+	if spec.Hostname != "" {
+		args = append(args, "--hostname", spec.Hostname)
+	}
+	if spec.Name != "" {
+		args = append(args, "--name", spec.Name)
+	}
+	if spec.Network != "" {
+		args = append(args, "--network", spec.Network)
+	}
+	for _, l := range spec.Labels {
+		args = append(args, "--label", l)
+	}
+	for _, a := range spec.Annotate {
+		// docker has no run-time annotations; a label is the closest
+		// thing OCI tooling can still read back
+		if rt.IsPodman() {
+			args = append(args, "--annotation", a)
+		} else {
+			args = append(args, "--label", a)
+		}
+	}
+
+	user := spec.User
+	switch spec.UserNS {
+	case "":
+	case "host":
+		args = append(args, "--userns", "host")
+	case "keep-id":
+		if !rt.IsPodman() {
+			return nil, fmt.Errorf("--userns keep-id is podman-only; docker already runs the container user with your uid")
+		}
+		args = append(args, "--userns", "keep-id")
+		// keep-id also makes the host uid the default user, but the
+		// entrypoint must start as root to create the account
+		if user == "" {
+			user = "root"
+		}
+	default:
+		return nil, fmt.Errorf("unknown --userns mode %q", spec.UserNS)
+	}
+	if user != "" {
+		args = append(args, "--user", user)
+	}
+	if spec.PID != "" {
+		args = append(args, "--pid", spec.PID)
+	}
+	if spec.IPC != "" {
+		args = append(args, "--ipc", spec.IPC)
+	}
+	if spec.Cgroup != "" {
+		args = append(args, "--cgroup-parent", spec.Cgroup)
+	}
+	if spec.Workdir != "" {
+		args = append(args, "--workdir", spec.Workdir)
+	}
+
+	// Values would be visible to anyone running ps, so the runtime reads
+	// them from its own environment instead; see RunEnv
+	for _, kv := range spec.Env {
+		key, _, _ := strings.Cut(kv, "=")
+		args = append(args, "-e", key)
+	}
+	for _, m := range spec.Mounts {
+		args = append(args, "-v", m)
+	}
+	for _, s := range spec.Security {
+		args = append(args, "--security-opt", s)
+	}
+	for _, h := range spec.AddHosts {
+		args = append(args, "--add-host", h)
+	}
+	for _, d := range spec.DNS {
+		args = append(args, "--dns", d)
+	}
+	for _, d := range spec.DNSSearch {
+		args = append(args, "--dns-search", d)
+	}
+	for _, d := range spec.Devices {
+		args = append(args, "--device", d)
+	}
+
+	for _, u := range spec.Ulimits {
+		args = append(args, "--ulimit", u)
+	}
+
+	if spec.GPUs != "" {
+		if rt.IsPodman() {
+			// podman exposes GPUs through CDI device names
+			for _, g := range strings.Split(spec.GPUs, ",") {
+				args = append(args, "--device", "nvidia.com/gpu="+g)
+			}
+		} else if spec.GPUs == "all" {
+			args = append(args, "--gpus", "all")
+		} else {
+			args = append(args, "--gpus", `"device=`+spec.GPUs+`"`)
+		}
+	}
+
+	args = append(args, spec.Extra...)
+
+	// With --init the shell is no longer PID 1: signals such as the TERM
+	// from `stop` reach it through the init process and take effect
+	// immediately, rather than being ignored until the kill timeout.
+	if spec.Init {
+		args = append(args, "--init")
+	}
+	if spec.StopWait != "" {
+		args = append(args, "--stop-timeout", spec.StopWait)
+	}
+
+	args = append(args, spec.Image)
+	return append(args, spec.Command...), nil
+}
+
+var gpuList = regexp.MustCompile(`^(all|[0-9]+(,[0-9]+)*)$`)
+
+// validateGPUs checks a --gpus value: "all" or a list of GPU indices.
+func validateGPUs(gpus string) error {
+	if !gpuList.MatchString(gpus) {
+		return fmt.Errorf("invalid GPU selection %q: want all or indices such as 0,1", gpus)
+	}
+	return nil
+}
+
+// validateUserNS checks a --userns mode.
+func validateUserNS(mode string) error {
+	switch mode {
+	case "host", "keep-id":
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (want host or keep-id)", mode)
+}
+
+var containerRef = regexp.MustCompile(`^container:[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// validatePIDMode checks a --pid value: host or container:<name|id>.
+func validatePIDMode(mode string) error {
+	if mode == "host" || containerRef.MatchString(mode) {
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (want host or container:<name>)", mode)
+}
+
+// validateIPCMode checks an --ipc value against the modes both runtimes
+// accept.
+func validateIPCMode(mode string) error {
+	switch mode {
+	case "none", "private", "shareable", "host":
+		return nil
+	}
+	if containerRef.MatchString(mode) {
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (want none, private, shareable, host or container:<name>)", mode)
+}
+
+var (
+	systemdSlice = regexp.MustCompile(`^[a-zA-Z0-9_.@-]+\.slice$`)
+	cgroupPath   = regexp.MustCompile(`^/?[a-zA-Z0-9_.@-]+(/[a-zA-Z0-9_.@-]+)*$`)
+)
+
+// validateCgroupParent checks a --cgroup-parent value. Its form depends on
+// the runtime's cgroup manager, not on the cgroup version: with the systemd
+// manager, the default on cgroup v2 hosts, it is a slice such as
+// machine-dev.slice; with cgroupfs, as on most cgroup v1 setups, it is a
+// path such as /linuxformac below the root of each hierarchy (v1) or of
+// the single unified hierarchy (v2). Rootless podman can only create
+// cgroups in the user's delegated systemd slice and needs cgroup v2.
+func validateCgroupParent(parent string) error {
+	if systemdSlice.MatchString(parent) {
+		return nil
+	}
+	if !cgroupPath.MatchString(parent) || slices.Contains(strings.Split(parent, "/"), "..") {
+		return fmt.Errorf("invalid cgroup %q: want a systemd slice such as machine-dev.slice or a path such as /linuxformac", parent)
+	}
+	return nil
+}
+
+// validateStopTimeout checks a --stop-timeout value: whole seconds, 0 or
+// more.
+func validateStopTimeout(seconds string) error {
+	n, err := strconv.Atoi(seconds)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%q is not a whole number of seconds", seconds)
+	}
+	return nil
+}
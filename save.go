@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// containerState is the part of a container's .State that tells how its
+// session ended.
+type containerState struct {
+	Status    string    `json:"Status"`
+	ExitCode  int       `json:"ExitCode"`
+	OOMKilled bool      `json:"OOMKilled"`
+	Error     string    `json:"Error"`
+	StartedAt time.Time `json:"StartedAt"`
+}
+
+// inspectState reads the state of container from the runtime.
+func inspectState(containerRuntime, container string) (containerState, error) {
+	var state containerState
+	out, err := exec.Command(containerRuntime, "inspect", "--type", "container", "--format", "{{json .State}}", container).Output()
+	if err != nil {
+		return state, fmt.Errorf("inspect %s: %w", container, err)
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return state, fmt.Errorf("parse state of %s: %w", container, err)
+	}
+	return state, nil
+}
+
+// unsavedReason returns why a session whose container ended in state should
+// not be saved without --save-always, or "" if it ended on its own. The
+// shell's exit status is not a reason: a user who interrupted a command and
+// then typed exit has ended the session as intended. stopped reports that
+// linuxformac stopped the container itself, e.g. after the idle timeout.
+func unsavedReason(state containerState, stopped bool) string {
+	switch {
+	case stopped:
+		return "the session was stopped"
+	case state.OOMKilled:
+		return "the container ran out of memory"
+	// The shell is PID 1, which nothing in the container can SIGKILL
+	case state.ExitCode == 128+int(syscall.SIGKILL):
+		return "the container was killed"
+	case state.Status == "running":
+		return "the container is still running"
+	}
+	return ""
+}
+
+// saveOnExit handles a --save-on-exit session once it has ended. The
+// container was started without --rm so its state survives the exit. It is
+// committed to tag if it ended on its own, or whenever it ran if saveAlways
+// is set, and is then removed. A container that never started is never
+// committed: there is no session to save.
+func saveOnExit(containerRuntime, container, tag string, stopped, saveAlways bool) {
+	state, err := inspectState(containerRuntime, container)
+	if err != nil {
+		log.Printf("Not saving to %s: the container was not created (%v).", tag, err)
+		return
+	}
+	defer func() {
+		if out, err := exec.Command(containerRuntime, "rm", "-f", container).CombinedOutput(); err != nil {
+			log.Printf("WARNING: could not remove %s: %v: %s", container, err, out)
+		}
+	}()
+
+	if state.StartedAt.IsZero() || state.Error != "" {
+		reason := "the container failed to start"
+		if state.Error != "" {
+			reason += ": " + strings.TrimSpace(state.Error)
+		}
+		log.Printf("Not saving to %s: %s.", tag, reason)
+		return
+	}
+	if reason := unsavedReason(state, stopped); reason != "" && !saveAlways {
+		log.Printf("Not saving to %s: %s (pass --save-always to save anyway).", tag, reason)
+		return
+	}
+
+	log.Printf("Saving %s to %s...", container, tag)
+	commitCmd := exec.Command(containerRuntime, "commit", container, tag)
+	commitCmd.Stderr = os.Stderr
+	if err := commitCmd.Run(); err != nil {
+		log.Printf("WARNING: could not save the session to %s: %v", tag, err)
+		return
+	}
+	log.Printf("Saved the session as %s.", tag)
+	emitEvent("container_saved", map[string]any{"name": container, "image": tag})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+)
+
+// runSelfcheck implements the hidden `linuxformac selfcheck` command. It lints
+// every embedded Dockerfile with `docker build --check`, which parses the
+// Dockerfile and runs build checks without building anything.
+func runSelfcheck() {
+	if err := selfcheck(os.Stdout); err != nil {
+		log.Fatalf("Selfcheck: %v", err)
+	}
+}
+
+// selfcheck lints the embedded Dockerfiles, writing one result line per
+// Dockerfile to w.
+func selfcheck(w io.Writer) error {
+	// podman build has no --check, so this always uses docker
+	if _, err := exec.LookPath("docker"); err != nil {
+		return fmt.Errorf("selfcheck needs docker with BuildKit (`docker build --check`)")
+	}
+
+	names, err := fs.Glob(dockerFiles, "dockerfiles/Dockerfile.*")
+	if err != nil {
+		return err
+	}
+
+	tmpParent, err := buildTmpDir("")
+	if err != nil {
+		return err
+	}
+	buildCtx, err := writeEmbeddedFiles(tmpParent)
+	if err != nil {
+		return fmt.Errorf("write build context: %w", err)
+	}
+	defer os.RemoveAll(buildCtx)
+	// Like a real build, the context has an overlay/ for the COPY to use
+	if err := os.MkdirAll(filepath.Join(buildCtx, "overlay"), 0755); err != nil {
+		return fmt.Errorf("write build context: %w", err)
+	}
+
+	var failed int
+	for _, name := range names {
+		dockerfile := path.Base(name)
+		checkCmd := exec.Command("docker", "build", "--check", "-f", filepath.Join(buildCtx, dockerfile), buildCtx)
+		out, err := checkCmd.CombinedOutput()
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s\n%s\n", dockerfile, out)
+			continue
+		}
+		fmt.Fprintf(w, "ok   %s\n", dockerfile)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d Dockerfiles failed checks", failed, len(names))
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestSelfcheck(t *testing.T) {
+	_, podmanErr := exec.LookPath("podman")
+	_, dockerErr := exec.LookPath("docker")
+	if podmanErr != nil && dockerErr != nil {
+		t.Skip("no container runtime (podman or docker) found")
+	}
+	// selfcheck lints with `docker build --check`, which podman lacks
+	if dockerErr != nil {
+		t.Skip("selfcheck needs docker; only podman found")
+	}
+	if err := checkDaemon("docker"); err != nil {
+		t.Skipf("docker is not usable: %v", err)
+	}
+
+	var out strings.Builder
+	if err := selfcheck(&out); err != nil {
+		t.Fatalf("selfcheck: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// signalCleanups are run, newest first, if linuxformac receives SIGHUP,
+// SIGINT or SIGTERM. signalMu is held while they run, so a release racing
+// the signal waits for them instead of cleaning up a second time.
+var (
+	signalMu       sync.Mutex
+	signalCleanups []*func()
+	signalCh       chan os.Signal
+)
+
+// trapSignals runs cleanup and exits if linuxformac receives SIGHUP, SIGINT
+// or SIGTERM before release is called. Containers started without --rm, and
+// the services of `up`, would otherwise be left behind when the terminal
+// closes or the process is killed. If a signal's cleanups are already
+// running, release blocks until they finish and the process exits.
+func trapSignals(cleanup func()) (release func()) {
+	signalMu.Lock()
+	defer signalMu.Unlock()
+	if signalCh == nil {
+		signalCh = make(chan os.Signal, 1)
+		go handleSignals(signalCh)
+	}
+	if len(signalCleanups) == 0 {
+		signal.Notify(signalCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	}
+	entry := &cleanup
+	signalCleanups = append(signalCleanups, entry)
+
+	return func() {
+		signalMu.Lock()
+		defer signalMu.Unlock()
+		signalCleanups = slices.DeleteFunc(signalCleanups, func(e *func()) bool { return e == entry })
+		if len(signalCleanups) == 0 {
+			signal.Stop(signalCh)
+		}
+	}
+}
+
+// handleSignals runs the registered cleanups on the first signal, then
+// exits with the conventional 128+n status.
+func handleSignals(sigs <-chan os.Signal) {
+	sig := <-sigs
+	// Never unlocked: the process exits with it held
+	signalMu.Lock()
+	log.Printf("Received %s; cleaning up.", sig)
+	for i := len(signalCleanups) - 1; i >= 0; i-- {
+		(*signalCleanups[i])()
+	}
+	code := 1
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runtimeStatus describes one installed container runtime.
+type runtimeStatus struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// machineStatus describes a podman machine on macOS.
+type machineStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+}
+
+// status is the report printed by `linuxformac status`.
+type status struct {
+	Runtimes    []runtimeStatus `json:"runtimes"`
+	Active      string          `json:"active_runtime,omitempty"`
+	Machines    []machineStatus `json:"podman_machines,omitempty"`
+	Images      []imageInfo     `json:"images"`
+	Containers  []string        `json:"running_containers"`
+	ImageBytes  int64           `json:"image_bytes"`
+	VolumeBytes int64           `json:"volume_bytes"`
+	Errors      []string        `json:"errors,omitempty"`
+}
+
+// collectStatus gathers the status report. Problems are recorded in the
+// report rather than returned, so it always describes what it could find.
+func collectStatus() *status {
+	st := &status{Images: []imageInfo{}, Containers: []string{}}
+	fail := func(format string, args ...any) {
+		st.Errors = append(st.Errors, fmt.Sprintf(format, args...))
+	}
+
+	for _, name := range []string{"podman", "docker"} {
+		if _, err := exec.LookPath(name); err != nil {
+			continue
+		}
+		rs := runtimeStatus{Name: name}
+		out, err := exec.Command(name, "version", "--format", "{{.Client.Version}}").Output()
+		if err != nil {
+			rs.Error = err.Error()
+		} else {
+			rs.Version = strings.TrimSpace(string(out))
+		}
+		st.Runtimes = append(st.Runtimes, rs)
+		if st.Active == "" {
+			st.Active = name
+		}
+	}
+	if st.Active == "" {
+		fail("no container runtime found")
+		return st
+	}
+
+	if runtime.GOOS == "darwin" && st.Active == "podman" {
+		out, err := exec.Command("podman", "machine", "list", "--format", "json").Output()
+		if err != nil {
+			fail("podman machine list: %v", err)
+		} else if err := json.Unmarshal(out, &st.Machines); err != nil {
+			fail("parse podman machine list: %v", err)
+		}
+	}
+
+	images, err := listImages(st.Active)
+	if err != nil {
+		fail("%v", err)
+	}
+	for _, img := range images {
+		st.Images = append(st.Images, img)
+		if size, err := imageSize(st.Active, img.ID); err == nil {
+			st.ImageBytes += size
+		}
+	}
+
+	containers, err := listContainers(st.Active, "")
+	if err != nil {
+		fail("%v", err)
+	}
+	for _, c := range containers {
+		st.Containers = append(st.Containers, c.Name)
+	}
+
+	dirs, err := volumeDirs()
+	if err != nil {
+		fail("%v", err)
+	}
+	for _, dir := range dirs {
+		if size, err := dirSize(dir); err == nil {
+			st.VolumeBytes += size
+		}
+	}
+	return st
+}
+
+// runStatus implements `linuxformac status [--json]`. Unlike doctor it
+// always exits zero; it only reports.
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	st := collectStatus()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(st); err != nil {
+			log.Printf("Status: %v", err)
+		}
+		return
+	}
+
+	for _, rs := range st.Runtimes {
+		fmt.Printf("Runtime:    %s %s\n", rs.Name, rs.Version)
+	}
+	for _, m := range st.Machines {
+		fmt.Printf("Machine:    %s (running: %t)\n", m.Name, m.Running)
+	}
+	fmt.Printf("Images:     %d (%s)\n", len(st.Images), formatBytes(st.ImageBytes))
+	fmt.Printf("Containers: %d running\n", len(st.Containers))
+	fmt.Printf("Volumes:    %s\n", formatBytes(st.VolumeBytes))
+	for _, e := range st.Errors {
+		fmt.Println("Problem:   ", e)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// hostZoneinfo is where both macOS and Linux keep the zoneinfo database.
+const hostZoneinfo = "/usr/share/zoneinfo"
+
+// hostTimezone returns the host's IANA zone name from $TZ or the
+// /etc/localtime symlink, or "" when neither names one.
+func hostTimezone() string {
+	if tz, ok := os.LookupEnv("TZ"); ok {
+		return strings.TrimPrefix(tz, ":")
+	}
+	target, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	// e.g. /var/db/timezone/zoneinfo/Europe/Paris on macOS
+	if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+		return name
+	}
+	return ""
+}
+
+// validateTimezone checks that tz is a zone in the zoneinfo database.
+func validateTimezone(tz string) error {
+	if strings.HasPrefix(tz, "/") || strings.Contains(tz, "..") {
+		return fmt.Errorf("%q is not a zone name such as America/New_York", tz)
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("unknown timezone %q", tz)
+	}
+	return nil
+}
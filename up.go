@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// upProject is a set of sidecar services that a linuxformac box runs
+// alongside. The services are described by a compose file, run with the
+// runtime's `compose`, or by a Kubernetes manifest, run with `podman kube
+// play`; either way they share one network with the box, on which compose
+// services are reachable by service name and kube pods by pod name.
+type upProject struct {
+	name    string
+	file    string
+	kube    bool
+	network string
+	// override is a generated compose file that names the default network
+	override string
+}
+
+var validProjectName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// topLevelKey matches a top-level YAML key such as "services:" or
+// "kind: Pod".
+var topLevelKey = regexp.MustCompile(`^([A-Za-z]+):`)
+
+// loadUpProject reads path and works out whether it is a compose file (it
+// has a top-level services key) or a kube file (it has a top-level kind).
+// The project is named after the file's directory.
+func loadUpProject(path string) (*upProject, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	p := &upProject{file: abs}
+	var compose bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		m := topLevelKey.FindStringSubmatch(scanner.Text())
+		switch {
+		case m == nil:
+		case m[1] == "services":
+			compose = true
+		case m[1] == "kind":
+			p.kube = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	switch {
+	case compose && p.kube:
+		return nil, fmt.Errorf("%s has both a top-level services and kind; cannot tell a compose file from a kube file", path)
+	case !compose && !p.kube:
+		return nil, fmt.Errorf("%s is neither a compose file (top-level services) nor a kube file (top-level kind)", path)
+	}
+
+	p.name = strings.ToLower(filepath.Base(filepath.Dir(abs)))
+	if !validProjectName.MatchString(p.name) {
+		return nil, fmt.Errorf("invalid project name %q from the directory of %s: use lowercase letters, digits, '_' or '-'", p.name, path)
+	}
+	p.network = "linuxformac-" + p.name
+	return p, nil
+}
+
+// runUp implements `linuxformac up <compose-or-kube-file> [distro] [launch
+// flags]`: it starts the file's services, runs the linuxformac box on
+// their network, and takes the services down when the session ends. Without
+// a distro the .linuxformac project file in the current directory is used.
+func runUp(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: linuxformac up <compose-or-kube-file> [distro] [launch flags]")
+	}
+	p, err := loadUpProject(args[0])
+	if err != nil {
+		log.Fatalf("Up: %v", err)
+	}
+
+	opts, err := parseArgs(args[1:])
+	if err != nil {
+		log.Fatalf("Up: %v", err)
+	}
+	if opts.distro == "" {
+		projectOpts, err := applyProjectFile(args[1:])
+		if err != nil {
+			log.Fatalf("Invalid project file: %v", err)
+		}
+		if projectOpts == nil {
+			log.Fatal("usage: linuxformac up <compose-or-kube-file> <distro> [launch flags], or add a .linuxformac project file")
+		}
+		opts = projectOpts
+	}
+	if opts.detach {
+		log.Fatal("up runs the box interactively; its services are taken down when the session ends.")
+	}
+	if opts.network != "" {
+		log.Fatalf("up connects the box to the services' network %s; do not pass --network.", p.network)
+	}
+	setupLogging(opts.verbose)
+	opts.network = p.network
+	exitIfInvalid(opts)
+
+	containerRuntime, err := detectRuntime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := checkDaemon(containerRuntime); err != nil {
+		log.Fatal(err)
+	}
+	if p.kube && containerRuntime != "podman" {
+		log.Fatalf("Up: %s is a kube file, which needs podman (`podman kube play`)", args[0])
+	}
+
+	exitOnError(p.run(containerRuntime, opts))
+}
+
+// run starts the services, runs the box on their network and takes the
+// services down again however the session ends, including on a signal.
+func (p *upProject) run(containerRuntime string, opts *options) error {
+	release := trapSignals(func() { p.down(containerRuntime) })
+	err := p.up(containerRuntime)
+	if err == nil {
+		fmt.Println("Linux Distro:", opts.distro)
+		err = initializeVM(opts)
+	}
+	release()
+	p.down(containerRuntime)
+	return err
+}
+
+// up starts the project's services in the background.
+func (p *upProject) up(containerRuntime string) error {
+	var args []string
+	if p.kube {
+		if err := exec.Command(containerRuntime, "network", "inspect", p.network).Run(); err != nil {
+			debugf("Creating network %s", p.network)
+			if out, err := exec.Command(containerRuntime, "network", "create", p.network).CombinedOutput(); err != nil {
+				return fmt.Errorf("create network %s: %w: %s", p.network, err, strings.TrimSpace(string(out)))
+			}
+		}
+		// --replace clears out pods a failed earlier run left behind
+		args = []string{"kube", "play", "--replace", "--network", p.network, p.file}
+	} else {
+		override, err := os.CreateTemp("", "linuxformac-up-*.yaml")
+		if err != nil {
+			return err
+		}
+		p.override = override.Name()
+		_, err = fmt.Fprintf(override, "networks:\n  default:\n    name: %s\n", p.network)
+		if cerr := override.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("write %s: %w", p.override, err)
+		}
+		args = append(p.composeArgs(), "up", "-d")
+	}
+
+	log.Printf("Starting the services of %s", p.name)
+	debugf("Run: %s %s", containerRuntime, strings.Join(args, " "))
+	cmd := exec.Command(containerRuntime, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("start the services of %s: %w", p.name, err)
+	}
+	return nil
+}
+
+// down stops and removes the project's services and its network.
+func (p *upProject) down(containerRuntime string) {
+	var args []string
+	switch {
+	case p.kube:
+		args = []string{"kube", "down", p.file}
+	case p.override != "":
+		defer os.Remove(p.override)
+		args = append(p.composeArgs(), "down", "--remove-orphans")
+	default:
+		return
+	}
+	log.Printf("Taking down the services of %s", p.name)
+	debugf("Run: %s %s", containerRuntime, strings.Join(args, " "))
+	if out, err := exec.Command(containerRuntime, args...).CombinedOutput(); err != nil {
+		log.Printf("Cannot take down the services of %s: %v: %s", p.name, err, strings.TrimSpace(string(out)))
+	}
+
+	// compose down removes the network it created; the kube network is ours
+	if p.kube {
+		if out, err := exec.Command(containerRuntime, "network", "rm", p.network).CombinedOutput(); err != nil {
+			log.Printf("Cannot remove network %s: %v: %s", p.network, err, strings.TrimSpace(string(out)))
+		}
+	}
+}
+
+// composeArgs returns the compose arguments selecting the project, its
+// file and the override that names its network.
+func (p *upProject) composeArgs() []string {
+	return []string{"compose", "-p", p.name, "-f", p.file, "-f", p.override}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var validUsername = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+// maxUsername is the longest login name useradd accepts.
+const maxUsername = 32
+
+// fallbackUsername is used when nothing of the host name is usable.
+const fallbackUsername = "user"
+
+// sanitizeUsername turns a host account name into something useradd inside
+// the image will accept. Directory-service names such as `DOMAIN\alice` or
+// `alice@corp` are reduced to the bare account name, any remaining
+// characters outside [a-z0-9_-] are replaced with underscores, and the
+// result is cut to maxUsername. A name with no letters or digits left
+// becomes fallbackUsername.
+func sanitizeUsername(name string) string {
+	clean := cleanUsername(name)
+	if len(clean) > maxUsername {
+		clean = clean[:maxUsername]
+	}
+	if strings.Trim(clean, "_-") == "" {
+		return fallbackUsername
+	}
+	return clean
+}
+
+func cleanUsername(name string) string {
+	if i := strings.LastIndex(name, `\`); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToLower(name)
+	if validUsername.MatchString(name) {
+		return name
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	clean := b.String()
+	if clean == "" || !validUsername.MatchString(clean) {
+		clean = "_" + clean
+	}
+	return clean
+}
+
+var userSpec = regexp.MustCompile(`^([a-z_][a-z0-9_-]*|[0-9]+)(:([a-z_][a-z0-9_-]*|[0-9]+))?$`)
+
+// validateUserSpec checks a --user value: a user name or uid, optionally
+// followed by :group or :gid.
+func validateUserSpec(spec string) error {
+	if !userSpec.MatchString(spec) {
+		return fmt.Errorf("invalid user %q: want name, uid, name:group or uid:gid", spec)
+	}
+	return nil
+}
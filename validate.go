@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// launchChecks holds the values validateLaunch resolved from the launch
+// flags, so that a launch uses exactly what was checked.
+type launchChecks struct {
+	seccomp     string
+	dataVolumes []volumeMount
+	cwdMount    string
+	relabel     string
+	limitArgs   []string
+	idleTimeout time.Duration
+	passEnv     []string
+	copyIn      []string
+}
+
+// validateLaunch checks every launch flag for opts.distro before anything
+// is built, pulled or created, and returns all problems together as a
+// flagErrors. It logs nothing and leaves opts unchanged, so it can run
+// more than once; warnLaunch logs the warnings.
+func validateLaunch(opts *options) (*launchChecks, error) {
+	var invalid flagErrors
+	c := &launchChecks{}
+
+	if _, ok := distroPath[opts.distro]; !ok {
+		invalid.add("unknown distro %q (supported: ubuntu, arch, fedora, debian, alpine)", opts.distro)
+	}
+
+	c.seccomp = opts.seccomp
+	if c.seccomp != "" && c.seccomp != "unconfined" {
+		abs, err := filepath.Abs(c.seccomp)
+		if err != nil {
+			invalid.add("Invalid seccomp profile path %q: %v", c.seccomp, err)
+		} else if info, err := os.Stat(abs); err != nil || info.IsDir() {
+			invalid.add("Seccomp profile %q not found or not a file", c.seccomp)
+		}
+		c.seccomp = abs
+	}
+
+	if opts.restart != "" {
+		if !opts.detach {
+			invalid.add("--restart requires --detach; interactive sessions are removed on exit.")
+		}
+		invalid.check("--restart", validateRestartPolicy(opts.restart))
+	}
+
+	if _, err := parseSize(opts.minFree); err != nil {
+		invalid.check("--min-free", err)
+	}
+
+	if opts.user != "" {
+		invalid.check("--user", validateUserSpec(opts.user))
+	}
+
+	if opts.tmpDir != "" || os.Getenv("LINUXFORMAC_TMPDIR") != "" {
+		dir, _ := buildTmpDir(opts.tmpDir)
+		invalid.check("--tmp-dir", validateTmpDir(dir))
+	}
+
+	if opts.context != "" {
+		invalid.check("--context", validateContextDir(opts.context))
+	}
+
+	if opts.registryPrefix != "" {
+		invalid.check("--registry-prefix", validateRegistryPrefix(opts.registryPrefix))
+	}
+	if opts.baseImage != "" {
+		invalid.check("--base-image", validateImageRef(opts.baseImage))
+	}
+
+	if opts.noVolume && opts.volumeName != "" {
+		invalid.add("--no-volume and --volume-name cannot be combined.")
+	}
+
+	targets := map[string]bool{"/data": !opts.noVolume}
+	for _, spec := range opts.dataVolumes {
+		vm, err := parseDataVolume(spec)
+		if err != nil {
+			invalid.check("--data-volume", err)
+			continue
+		}
+		if targets[vm.Target] {
+			invalid.add("Invalid --data-volume: %s is already a mount target", vm.Target)
+		}
+		targets[vm.Target] = true
+		c.dataVolumes = append(c.dataVolumes, vm)
+	}
+
+	if target := opts.mountCwd.value; target != "" {
+		target = filepath.Clean(target)
+		cwd, err := currentDir()
+		switch {
+		case !strings.HasPrefix(target, "/"):
+			invalid.add("Invalid --mount-cwd: %s is not an absolute path", target)
+		case targets[target]:
+			invalid.add("Invalid --mount-cwd: %s is already a mount target", target)
+		// The home directory is mounted over /home/<user> on macOS
+		case runtime.GOOS == "darwin" && (target == "/home" || strings.HasPrefix(target, "/home/")):
+			invalid.add("Invalid --mount-cwd: %s conflicts with the home directory mount", target)
+		case err != nil:
+			invalid.check("--mount-cwd", err)
+		}
+		targets[target] = true
+		c.cwdMount = cwd + ":" + target
+	}
+
+	if opts.volumeName != "" {
+		invalid.check("--volume-name", validateVolumeName(opts.volumeName))
+	}
+
+	if len(opts.devices) > 0 && runtime.GOOS == "darwin" {
+		invalid.add("--device is not supported on macOS: containers run inside a VM that cannot see host devices.")
+	}
+	for _, d := range opts.devices {
+		invalid.check("--device", validateDevice(d))
+	}
+
+	if opts.arch != "" {
+		invalid.check("--arch", validateArch(opts.arch))
+	}
+
+	if opts.target != "" {
+		if dockerfile, err := dockerfileFor(opts.distro, opts.arch); err != nil {
+			invalid.check("--target", err)
+		} else {
+			invalid.check("--target", validateTarget(dockerfile, opts.target))
+		}
+	}
+
+	if opts.gpus != "" {
+		if runtime.GOOS == "darwin" {
+			invalid.add("--gpus is not supported on macOS: containers run inside a VM that cannot see host GPUs.")
+		}
+		invalid.check("--gpus", validateGPUs(opts.gpus))
+	}
+
+	if opts.userNS != "" {
+		invalid.check("--userns", validateUserNS(opts.userNS))
+	}
+
+	if opts.saveOnExit != "" {
+		if opts.detach {
+			invalid.add("--save-on-exit saves when the session ends; it cannot be combined with --detach.")
+		}
+		invalid.check("--save-on-exit", validateImageRef(opts.saveOnExit))
+	} else if opts.saveAlways {
+		invalid.add("--save-always requires --save-on-exit.")
+	}
+
+	if opts.cgroupParent != "" {
+		invalid.check("--cgroup-parent", validateCgroupParent(opts.cgroupParent))
+	}
+
+	if opts.stopTimeout != "" {
+		invalid.check("--stop-timeout", validateStopTimeout(opts.stopTimeout))
+	}
+
+	if opts.pid != "" {
+		invalid.check("--pid", validatePIDMode(opts.pid))
+	}
+	if opts.ipc != "" {
+		invalid.check("--ipc", validateIPCMode(opts.ipc))
+	}
+
+	var err error
+	c.relabel, err = selinuxRelabel(opts.selinuxLabel)
+	invalid.check("--selinux-label", err)
+
+	for _, u := range opts.ulimits {
+		invalid.check("--ulimit", validateUlimit(u))
+	}
+
+	c.limitArgs, err = memoryArgs(opts)
+	if err != nil {
+		invalid.add("Invalid memory options: %v", err)
+	}
+	cpuFlags, err := cpuArgs(opts)
+	if err != nil {
+		invalid.add("Invalid %v", err)
+	}
+	c.limitArgs = append(c.limitArgs, cpuFlags...)
+
+	if opts.idleTimeout != "" {
+		c.idleTimeout, err = time.ParseDuration(opts.idleTimeout)
+		if err != nil || c.idleTimeout <= 0 {
+			invalid.add("Invalid --idle-timeout %q: want a positive duration such as 30m", opts.idleTimeout)
+		}
+		if opts.detach || !term.IsTerminal(int(os.Stdin.Fd())) {
+			invalid.add("--idle-timeout needs an interactive session on a terminal.")
+		}
+	}
+
+	c.passEnv, err = launchEnv(opts)
+	if err != nil {
+		invalid.add("Invalid %v", err)
+	}
+
+	if opts.tmux && len(opts.command) > 0 {
+		invalid.add("--tmux starts an interactive shell; it cannot be combined with a command after --.")
+	}
+
+	if opts.runFile != "" {
+		if len(opts.command) > 0 || opts.tmux || opts.detach {
+			invalid.add("--run-file runs its script instead of the shell; it cannot be combined with a command after --, --tmux or --detach.")
+		}
+		// Only stat it: opening a pipe such as <(...) would consume it
+		_, err := os.Stat(opts.runFile)
+		invalid.check("--run-file", err)
+	}
+
+	c.copyIn = slices.Clone(opts.copyIn)
+	if opts.initScript != "" {
+		if info, err := os.Stat(opts.initScript); err != nil || !info.Mode().IsRegular() {
+			invalid.add("Invalid --init-script: %s is not a readable file", opts.initScript)
+		} else {
+			// Copied in before start, then run by the entrypoint
+			c.copyIn = append(c.copyIn, opts.initScript+":"+containerInitScript)
+		}
+	}
+
+	for _, cp := range c.copyIn {
+		invalid.check("--copy-in", validateCopyIn(cp))
+	}
+
+	for _, h := range opts.addHosts {
+		invalid.check("--add-host", validateAddHost(h))
+	}
+
+	for _, a := range opts.annotations {
+		invalid.check("--annotation", validateAnnotation(a))
+	}
+
+	for _, d := range opts.dns {
+		invalid.check("--dns", validateDNS(d))
+	}
+	for _, d := range opts.dnsSearch {
+		invalid.check("--dns-search", validateDNSSearch(d))
+	}
+
+	if len(invalid) > 0 {
+		return nil, invalid
+	}
+	return c, nil
+}
+
+// warnLaunch logs the warnings for risky but valid launch flags, once per
+// launch.
+func warnLaunch(opts *options) {
+	if opts.envAll {
+		log.Println("WARNING: --env-all forwards your whole environment, including any tokens or secrets in it.")
+	}
+	if opts.context != "" {
+		if size, err := dirSize(opts.context); err == nil && size > largeContext {
+			log.Printf("WARNING: build context %s is %s; builds may be slow.", opts.context, formatBytes(size))
+		}
+	}
+	if opts.tz == "" {
+		if tz := hostTimezone(); tz != "" && validateTimezone(tz) != nil {
+			debugf("Ignoring host timezone %q", tz)
+		}
+	}
+	if opts.selinuxLabel == "" {
+		if relabel, _ := selinuxRelabel(""); relabel != "" {
+			debugf("SELinux is enforcing; relabeling volume mounts with :%s", relabel)
+		}
+	}
+	if opts.seccomp == "unconfined" {
+		log.Println("WARNING: seccomp is unconfined; the container can make any syscall.")
+	}
+	if opts.arch != "" && opts.arch != runtime.GOARCH {
+		log.Printf("Running %s under emulation; expect it to be slower than native.", opts.arch)
+	}
+	if opts.pid == "host" {
+		log.Println("WARNING: --pid host lets the container see, signal and (as root) trace every host process.")
+	}
+	if opts.ipc == "host" {
+		log.Println("WARNING: --ipc host shares the host's shared memory and message queues with the container.")
+	}
+}
+
+// exitIfInvalid validates opts with validateLaunch and exits, reporting
+// every problem, if any flag is invalid.
+func exitIfInvalid(opts *options) {
+	_, err := validateLaunch(opts)
+	var invalid flagErrors
+	if errors.As(err, &invalid) {
+		invalid.exitIfAny()
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// runOpen implements `linuxformac open <distro|volume-name>`, showing the
+// persistent volume in the host file manager.
+func runOpen(args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: linuxformac open <distro|volume-name>")
+	}
+	if err := validateVolumeName(args[0]); err != nil {
+		log.Fatal(err)
+	}
+
+	path, err := volumePath(args[0])
+	if err != nil {
+		log.Fatalf("Open: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		log.Fatalf("No volume at %s; launch %s first to create it.", path, args[0])
+	}
+	fmt.Println(path)
+
+	opener := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		opener = "open"
+	}
+	if err := exec.Command(opener, path).Run(); err != nil {
+		log.Fatalf("Open %s with %s: %v", path, opener, err)
+	}
+}
+
+// runVolume implements `linuxformac volume <subcommand>`.
+func runVolume(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: linuxformac volume rename <old> <new>")
+	}
+	switch args[0] {
+	case "rename":
+		if len(args) != 3 {
+			log.Fatal("usage: linuxformac volume rename <old> <new>")
+		}
+		if err := renameVolume(args[1], args[2]); err != nil {
+			log.Fatalf("Rename volume: %v", err)
+		}
+	default:
+		log.Fatalf("unknown volume command %q (supported: rename)", args[0])
+	}
+}
+
+// renameVolume moves the <old>_Volume directory to <new>_Volume in the
+// volumes directory, which also migrates a legacy volume out of the home
+// directory. A volume mounted by a container is left alone.
+func renameVolume(oldName, newName string) error {
+	for _, name := range []string{oldName, newName} {
+		if err := validateVolumeName(name); err != nil {
+			return err
+		}
+	}
+
+	src, err := volumePath(oldName)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return fmt.Errorf("no volume %s at %s", oldName, src)
+	}
+	if _, err := os.Stat(filepath.Join(src, volumeMarker)); err != nil {
+		return fmt.Errorf("%s was not created by linuxformac; move it yourself", src)
+	}
+
+	existing, err := volumePath(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(existing); err == nil {
+		return fmt.Errorf("%s already exists", existing)
+	}
+	dir, err := volumesDir()
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, newName+"_Volume")
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	if containerRuntime, err := detectRuntime(); err != nil {
+		log.Printf("WARNING: cannot check whether %s is in use: %v", src, err)
+	} else if names, err := containersMounting(containerRuntime, src); err != nil {
+		log.Printf("WARNING: cannot check whether %s is in use: %v", src, err)
+	} else if len(names) > 0 {
+		return fmt.Errorf("%s is mounted by %s; stop it first", src, strings.Join(names, ", "))
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create volumes dir: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("move %s: %w", src, err)
+	}
+	// Rewrite the marker so the volume is recognised under its new name
+	if err := os.WriteFile(filepath.Join(dst, volumeMarker), nil, 0644); err != nil {
+		return fmt.Errorf("write volume marker: %w", err)
+	}
+	fmt.Printf("Renamed %s to %s\n", src, dst)
+	return nil
+}
+
+// containersMounting returns the names of linuxformac containers, running
+// or stopped, that bind-mount the host directory path.
+func containersMounting(containerRuntime, path string) ([]string, error) {
+	out, err := exec.Command(containerRuntime, "ps", "-aq", "--filter", "label="+labelDistro).Output()
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	format := "{{.Name}}{{range .Mounts}}\t{{.Source}}{{end}}"
+	out, err = exec.Command(containerRuntime, append([]string{"inspect", "--format", format}, ids...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("inspect containers: %w", err)
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		for _, source := range fields[1:] {
+			if source == path {
+				names = append(names, strings.TrimPrefix(fields[0], "/"))
+				break
+			}
+		}
+	}
+	return names, scanner.Err()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// xdgDir resolves an XDG base directory for linuxformac: $env/linuxformac if
+// env holds an absolute path, otherwise ~/fallback/linuxformac. Relative
+// values are ignored, as the XDG spec requires.
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "linuxformac"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("get home dir: %w", err)
+	}
+	return filepath.Join(home, fallback, "linuxformac"), nil
+}
+
+// configDir holds user configuration ($XDG_CONFIG_HOME, default ~/.config).
+func configDir() (string, error) { return xdgDir("XDG_CONFIG_HOME", ".config") }
+
+// dataDir holds volumes and launch history ($XDG_DATA_HOME, default ~/.local/share).
+func dataDir() (string, error) { return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share")) }
+
+// cacheDir holds build contexts ($XDG_CACHE_HOME, default ~/.cache).
+func cacheDir() (string, error) { return xdgDir("XDG_CACHE_HOME", ".cache") }
+
+// volumesDir is where persistent volumes are created.
+func volumesDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "volumes"), nil
+}
+
+// volumePath returns the host directory for the volume <name>_Volume.
+// Volumes created before XDG support lived directly in the home directory;
+// such a volume keeps being used until it is moved.
+func volumePath(name string) (string, error) {
+	dir, err := volumesDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name+"_Volume")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(home, name+"_Volume")
+		if info, err := os.Stat(legacy); err == nil && info.IsDir() {
+			return legacy, nil
+		}
+	}
+	return path, nil
+}